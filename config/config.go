@@ -0,0 +1,164 @@
+// Package config reads the editor's configuration file. The file is written
+// in a subset of TOML: "key = value" settings grouped under "[section]"
+// headers, with values that are booleans, integers or quoted strings, and
+// comments starting with '#'. Keys that are not made of letters, digits, '_'
+// and '-' are quoted like strings:
+//
+//	tabwidth = 4
+//	theme = "dark"
+//
+//	[filetype.py]
+//	expandtab = true
+//
+//	[keys.edit]
+//	"<C-x>" = "save"
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Config maps section names to the settings in each section. Settings before
+// the first section header are in the section "". Values are kept in their
+// string form: quoted strings are unquoted and other values are unchanged.
+type Config map[string]map[string]string
+
+// DefaultPath returns the path of the user's config file.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "editor", "config.toml")
+}
+
+// Load reads the config file at path. A missing file is an empty config.
+func Load(path string) (Config, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Config{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v:%v", path, err)
+	}
+	return c, nil
+}
+
+var (
+	sectionRe = regexp.MustCompile(`^\[\s*([A-Za-z0-9_.-]+)\s*\]$`)
+	keyRe     = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	bareRe    = regexp.MustCompile(`^(true|false|[+-]?[0-9]+)$`)
+)
+
+// Parse parses a config file. Errors start with the line number they were
+// found on.
+func Parse(r io.Reader) (Config, error) {
+	c := Config{}
+	section := ""
+	scan := bufio.NewScanner(r)
+	for n := 1; scan.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scan.Text()))
+		if line == "" {
+			continue
+		}
+		if m := sectionRe.FindStringSubmatch(line); m != nil {
+			section = m[1]
+			continue
+		}
+
+		key, val, ok := splitKey(line)
+		if !ok {
+			return nil, fmt.Errorf("%v: expected key = value", n)
+		}
+		if !keyRe.MatchString(key) {
+			k, err := value(key)
+			if err != nil || (key[0] != '"' && key[0] != '\'') {
+				return nil, fmt.Errorf("%v: invalid key %v", n, key)
+			}
+			key = k
+		}
+		v, err := value(val)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", n, err)
+		}
+		if c[section] == nil {
+			c[section] = map[string]string{}
+		}
+		c[section][key] = v
+	}
+	return c, scan.Err()
+}
+
+// value returns the string form of a value.
+func value(val string) (string, error) {
+	switch {
+	case strings.HasPrefix(val, `"`):
+		s, err := strconv.Unquote(val)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %v", val)
+		}
+		return s, nil
+	case strings.HasPrefix(val, "'"):
+		if len(val) < 2 || !strings.HasSuffix(val, "'") || strings.Contains(val[1:len(val)-1], "'") {
+			return "", fmt.Errorf("invalid string %v", val)
+		}
+		return val[1 : len(val)-1], nil
+	case bareRe.MatchString(val):
+		return val, nil
+	}
+	return "", fmt.Errorf("invalid value %q", val)
+}
+
+// splitKey splits a "key = value" line at the '=' following the key, which
+// may be quoted.
+func splitKey(line string) (key, val string, ok bool) {
+	end := 0
+	if q := line[0]; q == '"' || q == '\'' {
+		for end = 1; end < len(line) && line[end] != q; end++ {
+			if q == '"' && line[end] == '\\' {
+				end++
+			}
+		}
+		if end++; end > len(line) {
+			return "", "", false
+		}
+	}
+	i := strings.Index(line[end:], "=")
+	if i == -1 {
+		return "", "", false
+	}
+	i += end
+	key, val = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+	return key, val, key != ""
+}
+
+// stripComment removes a comment from the end of line, leaving '#' inside
+// quoted strings alone.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type parsetest struct {
+	text   string
+	expect Config
+}
+
+var parsetests = []parsetest{
+	{"", Config{}},
+	{"tabwidth = 8\nexpandtab=true # spaces\n", Config{"": {"tabwidth": "8", "expandtab": "true"}}},
+	{"theme = \"a # b\"\n[filetype.go]\nexpandtab = false\n", Config{"": {"theme": "a # b"}, "filetype.go": {"expandtab": "false"}}},
+	{"# comment\n\n[ x ]\nk = 'c:\\dir'\n", Config{"x": {"k": "c:\\dir"}}},
+	{"k = \"tab\\tend\"", Config{"": {"k": "tab\tend"}}},
+	{"[keys.edit]\n\"<C-x>\" = \"save\"\n'=' = 'x'\n\"a\\\"=\" = \"\"\n", Config{"keys.edit": {"<C-x>": "save", "=": "x", "a\"=": ""}}},
+}
+
+func TestParse(t *testing.T) {
+	for i, test := range parsetests {
+		c, err := Parse(strings.NewReader(test.text))
+		if err != nil {
+			t.Errorf("test %v: %v", i, err)
+		} else if !reflect.DeepEqual(c, test.expect) {
+			t.Errorf("test %v: expected %v, got %v", i, test.expect, c)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	bad := []string{"key", "k = bare", "k = \"open", "k = 'a'b'", "[unclosed", "bad key = 1", "\"open = 1", "\"k\" 1"}
+	for _, text := range bad {
+		if _, err := Parse(strings.NewReader(text)); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
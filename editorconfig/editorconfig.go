@@ -0,0 +1,323 @@
+// Package editorconfig reads EditorConfig files (see editorconfig.org), which
+// set properties such as the indent style for the files in a directory tree:
+//
+//	root = true
+//
+//	[*]
+//	end_of_line = lf
+//
+//	[*.{js,py}]
+//	indent_style = space
+//	indent_size = 4
+package editorconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Name is the name of EditorConfig files.
+const Name = ".editorconfig"
+
+// Properties maps property names to values. Both are lower case.
+type Properties map[string]string
+
+// Section is a set of properties for the files matching Glob.
+type Section struct {
+	Glob  string
+	Props Properties
+}
+
+// File is a parsed EditorConfig file.
+type File struct {
+	// Root is true if files in parent directories are not to be read.
+	Root     bool
+	Sections []Section
+}
+
+// Parse parses an EditorConfig file. Errors start with the line number they
+// were found on.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	var sec *Section
+	scan := bufio.NewScanner(r)
+	for n := 1; scan.Scan(); n++ {
+		line := strings.TrimSpace(scan.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if len(line) < 3 || line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("%v: invalid section header", n)
+			}
+			f.Sections = append(f.Sections, Section{Glob: line[1 : len(line)-1], Props: Properties{}})
+			sec = &f.Sections[len(f.Sections)-1]
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("%v: expected key = value", n)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.ToLower(strings.TrimSpace(line[i+1:]))
+		if key == "" {
+			return nil, fmt.Errorf("%v: missing key", n)
+		}
+		if sec != nil {
+			sec.Props[key] = val
+		} else if key == "root" {
+			f.Root = val == "true"
+		}
+	}
+	return f, scan.Err()
+}
+
+// Properties returns the properties the file gives the file name, which is
+// slash separated and relative to the directory the EditorConfig file is in.
+// Later sections override earlier ones.
+func (f *File) Properties(name string) Properties {
+	props := Properties{}
+	for _, sec := range f.Sections {
+		if Match(sec.Glob, name) {
+			for k, v := range sec.Props {
+				props[k] = v
+			}
+		}
+	}
+	return props
+}
+
+// Find returns the properties for the file at path from the EditorConfig
+// files in its directory and those above it, up to the first one with
+// root = true. Files nearer to path override those further away, and
+// properties set to "unset" are left out.
+func Find(path string) (Properties, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*File
+	var dirs []string
+	for dir := filepath.Dir(path); ; {
+		f, err := parseFile(filepath.Join(dir, Name))
+		if err != nil {
+			return nil, err
+		} else if f != nil {
+			files = append(files, f)
+			dirs = append(dirs, dir)
+			if f.Root {
+				break
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	props := Properties{}
+	for i := len(files) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], path)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range files[i].Properties(filepath.ToSlash(rel)) {
+			props[k] = v
+		}
+	}
+	for k, v := range props {
+		if v == "unset" {
+			delete(props, k)
+		}
+	}
+	return props, nil
+}
+
+// parseFile parses the EditorConfig file at path. It returns nil if there is
+// no such file.
+func parseFile(path string) (*File, error) {
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%v:%v", path, err)
+	}
+	return f, nil
+}
+
+// Match returns true if the slash separated file name matches glob. A glob
+// without a slash matches the base name of files in any directory; otherwise
+// it matches the whole name. Globs can contain
+//
+//	**            any string
+//	*             any string without a slash
+//	?             any character but a slash
+//	[abc], [!abc] any character in, or not in, the set
+//	{a,b,c}       any of the comma separated globs
+//	{n1..n2}      any integer from n1 to n2
+//	\c            the character c
+func Match(glob, name string) bool {
+	var ranges [][2]int
+	expr := translate(strings.TrimPrefix(glob, "/"), &ranges)
+	if !strings.Contains(glob, "/") {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return false
+	}
+
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return false
+	}
+	for i, r := range ranges {
+		if m[i+1] == "" {
+			continue // in an alternative that did not match
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < r[0] || n > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+var numRangeRe = regexp.MustCompile(`^([+-]?[0-9]+)\.\.([+-]?[0-9]+)$`)
+
+// translate returns the regular expression for glob. Numeric ranges become
+// capturing groups; their bounds are appended to ranges in order.
+func translate(glob string, ranges *[][2]int) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j == -1 || strings.Contains(glob[i+1:i+1+j], "/") {
+				b.WriteString(`\[`)
+				continue
+			}
+			set := glob[i+1 : i+1+j]
+			b.WriteString("[")
+			if strings.HasPrefix(set, "!") {
+				b.WriteString("^")
+				set = set[1:]
+			}
+			for _, r := range set {
+				if r == '-' {
+					b.WriteRune(r)
+				} else {
+					b.WriteString(regexp.QuoteMeta(string(r)))
+				}
+			}
+			b.WriteString("]")
+			i += j + 1
+		case '{':
+			j := closingBrace(glob, i)
+			if j == -1 {
+				b.WriteString(`\{`)
+				continue
+			}
+			inner := glob[i+1 : j]
+			alts := splitAlternatives(inner)
+			if m := numRangeRe.FindStringSubmatch(inner); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				*ranges = append(*ranges, [2]int{lo, hi})
+				b.WriteString("([+-]?[0-9]+)")
+			} else if len(alts) > 1 {
+				b.WriteString("(?:")
+				for k, alt := range alts {
+					if k > 0 {
+						b.WriteString("|")
+					}
+					b.WriteString(translate(alt, ranges))
+				}
+				b.WriteString(")")
+			} else {
+				// a single alternative is taken literally
+				b.WriteString(`\{` + translate(inner, ranges) + `\}`)
+			}
+			i = j
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// closingBrace returns the index of the brace closing the one at glob[i], or
+// -1 if there is none.
+func closingBrace(glob string, i int) int {
+	depth := 0
+	for ; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitAlternatives splits s at the commas not nested in braces.
+func splitAlternatives(s string) []string {
+	var alts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alts, s[start:])
+}
@@ -0,0 +1,101 @@
+package editorconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type matchtest struct {
+	glob, name string
+	expect     bool
+}
+
+var matchtests = []matchtest{
+	{"*", "a.go", true},
+	{"*", "dir/a.go", true},
+	{"*.go", "a.go", true},
+	{"*.go", "dir/sub/a.go", true},
+	{"*.go", "a.go.txt", false},
+	{"a.go", "dir/a.go", true},
+	{"a.go", "dir/ba.go", false},
+	{"dir/*.go", "dir/a.go", true},
+	{"dir/*.go", "dir/sub/a.go", false},
+	{"dir/*.go", "x/dir/a.go", false},
+	{"/a.go", "a.go", true},
+	{"/a.go", "dir/a.go", false},
+	{"dir/**.go", "dir/sub/a.go", true},
+	{"**/a.go", "a.go", true},
+	{"dir/**/a.go", "dir/a.go", true},
+	{"dir/**/a.go", "dir/x/y/a.go", true},
+	{"?.go", "a.go", true},
+	{"?.go", "ab.go", false},
+	{"dir?a.go", "dir/a.go", false},
+	{"[ab].go", "b.go", true},
+	{"[ab].go", "c.go", false},
+	{"[!ab].go", "c.go", true},
+	{"[!ab].go", "a.go", false},
+	{"[a-c].go", "b.go", true},
+	{"[a-c].go", "d.go", false},
+	{"*.{js,py}", "a.py", true},
+	{"*.{js,py}", "a.js", true},
+	{"*.{js,py}", "a.go", false},
+	{"{a,{b,c}}.go", "c.go", true},
+	{"{*.go,Makefile}", "dir/Makefile", true},
+	{"{single}.go", "{single}.go", true},
+	{"{single}.go", "single.go", false},
+	{"{a", "{a", true},
+	{"file{1..3}", "file2", true},
+	{"file{1..3}", "file4", false},
+	{"file{-2..2}", "file-1", true},
+	{"file{1..3}", "fileb", false},
+	{"{a,file{1..3}}", "a", true},
+	{`\*.go`, "*.go", true},
+	{`\*.go`, "a.go", false},
+	{"a.b", "axb", false},
+	{"[ab", "[ab", true},
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range matchtests {
+		if got := Match(test.glob, test.name); got != test.expect {
+			t.Errorf("Match(%q, %q): expected %v, got %v", test.glob, test.name, test.expect, got)
+		}
+	}
+}
+
+const testFile = `root = true
+
+[*]
+indent_style = tab
+end_of_line = LF
+
+; python
+[*.py]
+indent_style = space
+indent_size = 4
+
+[lib/**.py]
+indent_size = 2
+`
+
+func TestProperties(t *testing.T) {
+	f, err := Parse(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Root {
+		t.Errorf("expected root = true")
+	}
+
+	tests := map[string]Properties{
+		"a.go":       {"indent_style": "tab", "end_of_line": "lf"},
+		"a.py":       {"indent_style": "space", "indent_size": "4", "end_of_line": "lf"},
+		"lib/x/a.py": {"indent_style": "space", "indent_size": "2", "end_of_line": "lf"},
+	}
+	for name, expect := range tests {
+		if got := f.Properties(name); !reflect.DeepEqual(got, expect) {
+			t.Errorf("%v: expected %v, got %v", name, expect, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package highlight
+
+import (
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+const (
+	goCode State = iota
+	goComment
+	goRawString
+)
+
+var goBuiltins = map[string]bool{
+	"bool": true, "byte": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true,
+	"int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+	"string": true, "uint": true, "uint8": true, "uint16": true,
+	"uint32": true, "uint64": true, "uintptr": true, "any": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "close": true, "complex": true,
+	"copy": true, "delete": true, "imag": true, "len": true, "make": true,
+	"new": true, "panic": true, "print": true, "println": true,
+	"real": true, "recover": true, "min": true, "max": true, "clear": true,
+}
+
+// GoLexer lexes Go source code using go/scanner.
+type GoLexer struct{}
+
+func (GoLexer) Lex(line []rune, st State) ([]Class, State) {
+	src := []byte(string(line))
+	classes := make([]Class, len(line))
+
+	// runes maps byte offsets in src to rune indices in line
+	runes := make([]int, len(src)+1)
+	r := 0
+	for n := range src {
+		runes[n] = r
+		if n+1 < len(src) && src[n+1]&0xC0 != 0x80 {
+			r++
+		}
+	}
+	runes[len(src)] = len(line)
+
+	mark := func(start, end int, c Class) {
+		for i := runes[start]; i < runes[end]; i++ {
+			classes[i] = c
+		}
+	}
+
+	pos := 0
+	switch st {
+	case goComment:
+		i := strings.Index(string(src), "*/")
+		if i == -1 {
+			mark(0, len(src), Comment)
+			return classes, goComment
+		}
+		pos = i + 2
+		mark(0, pos, Comment)
+	case goRawString:
+		i := strings.IndexByte(string(src), '`')
+		if i == -1 {
+			mark(0, len(src), String)
+			return classes, goRawString
+		}
+		pos = i + 1
+		mark(0, pos, String)
+	}
+
+	fset := token.NewFileSet()
+	rest := src[pos:]
+	file := fset.AddFile("", fset.Base(), len(rest))
+	var s scanner.Scanner
+	s.Init(file, rest, func(token.Position, string) {}, scanner.ScanComments)
+
+	next := goCode
+	for {
+		p, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		start := pos + file.Offset(p)
+		if start >= len(src) || (tok == token.SEMICOLON && lit == "\n") {
+			continue
+		}
+		end := start + len(lit)
+		if lit == "" {
+			end = start + len(tok.String())
+		}
+		if end > len(src) {
+			end = len(src)
+		}
+
+		switch {
+		case tok == token.COMMENT:
+			mark(start, end, Comment)
+			if strings.HasPrefix(lit, "/*") && (len(lit) < 4 || !strings.HasSuffix(lit, "*/")) {
+				next = goComment
+			}
+		case tok == token.STRING:
+			mark(start, end, String)
+			if lit[0] == '`' && (len(lit) < 2 || lit[len(lit)-1] != '`') {
+				mark(start, len(src), String)
+				next = goRawString
+			}
+		case tok == token.CHAR:
+			mark(start, end, String)
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			mark(start, end, Number)
+		case tok == token.IDENT && goBuiltins[lit]:
+			mark(start, end, Builtin)
+		case tok.IsKeyword():
+			mark(start, end, Keyword)
+		case tok.IsOperator():
+			mark(start, end, Operator)
+		}
+	}
+	return classes, next
+}
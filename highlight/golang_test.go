@@ -0,0 +1,91 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+// classCodes abbreviates classes in expected results, one letter per rune.
+var classCodes = map[rune]Class{
+	'.': Plain, 'k': Keyword, 'b': Builtin, 's': String,
+	'n': Number, 'c': Comment, 'o': Operator,
+}
+
+// lextest holds lines of Go source lexed in order, each followed by the
+// classes of its runes.
+type lextest struct {
+	lines []string
+}
+
+var lextests = []lextest{
+	{[]string{
+		"x := 1.5",
+		"..oo.nnn",
+	}},
+	{[]string{
+		"func f() int {",
+		"kkkk..oo.bbb.o",
+	}},
+	{[]string{
+		`s := "héllo" // ü`,
+		`..oo.sssssss.cccc`,
+	}},
+	{[]string{
+		"r := 'ü' + len(日本)",
+		"..oo.sss.o.bbbo..o",
+	}},
+	{[]string{
+		"a /* b",
+		"..cccc",
+		"c",
+		"c",
+		"d */ e",
+		"cccc..",
+	}},
+	{[]string{
+		"/**/ x /*/",
+		"cccc...ccc",
+	}},
+	{[]string{
+		"s := `a",
+		"..oo.ss",
+		"ü \"b\"",
+		"sssss",
+		"c` + 1",
+		"ss.o.n",
+	}},
+	{[]string{
+		"/* é",
+		"cccc",
+		"ü */ x := `",
+		"cccc...oo.s",
+		"` // done",
+		"s.ccccccc",
+	}},
+}
+
+func TestGoLexer(t *testing.T) {
+	for i, test := range lextests {
+		var st State
+		for j := 0; j < len(test.lines); j += 2 {
+			line := []rune(test.lines[j] + "\n")
+			var classes []Class
+			classes, st = GoLexer{}.Lex(line, st)
+			if len(classes) != len(line) {
+				t.Fatalf("test %v line %v: expected %v classes, got %v", i, j/2, len(line), len(classes))
+			}
+
+			var got strings.Builder
+			for _, c := range classes[:len(line)-1] {
+				for code, class := range classCodes {
+					if class == c {
+						got.WriteRune(code)
+					}
+				}
+			}
+			if expect := test.lines[j+1]; got.String() != expect {
+				t.Errorf("test %v line %v: %q\nexpected %v\n     got %v", i, j/2, test.lines[j], expect, got.String())
+			}
+		}
+	}
+}
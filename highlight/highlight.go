@@ -0,0 +1,114 @@
+// Package highlight colours buffer text according to the syntax of its
+// language.
+package highlight
+
+import (
+	"path/filepath"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/util"
+)
+
+// Class is the syntactic class of a piece of text.
+type Class int
+
+const (
+	Plain Class = iota
+	Keyword
+	Builtin
+	String
+	Number
+	Comment
+	Operator
+)
+
+var classNames = []string{"plain", "keyword", "builtin", "string", "number", "comment", "operator"}
+
+func (c Class) String() string { return classNames[c] }
+
+// State is the part of a lexer's state carried from the end of one line to
+// the start of the next, such as being inside a block comment. The zero State
+// is the state at the start of a file.
+type State int
+
+// Lexer classifies the text of a language one line at a time.
+type Lexer interface {
+	// Lex returns the class of every rune in line, which starts in state
+	// st, and the state at the end of the line.
+	Lex(line []rune, st State) (classes []Class, next State)
+}
+
+var lexers = map[string]Lexer{
+	".go": GoLexer{},
+}
+
+// ForFile returns the lexer for the language of the named file, or nil if
+// there is none.
+func ForFile(name string) Lexer {
+	return lexers[filepath.Ext(name)]
+}
+
+// DefaultColors are the colours used for each class when a Highlighter has no
+// Colors function.
+var DefaultColors = map[Class]termbox.Attribute{
+	Keyword:  termbox.ColorYellow,
+	Builtin:  termbox.ColorGreen,
+	String:   termbox.ColorRed,
+	Number:   termbox.ColorMagenta,
+	Comment:  termbox.ColorCyan,
+	Operator: termbox.ColorDefault,
+}
+
+type lineInfo struct {
+	classes []Class
+	end     State
+}
+
+// Highlighter implements util.Styler using a Lexer. Lexed lines are cached;
+// an edit discards the cache from the edited line on and lines are lexed
+// again only as far down as they are drawn.
+type Highlighter struct {
+	b     *util.Buffer
+	lex   Lexer
+	lines []lineInfo // lines[i] holds the lexed line i
+	// Colors returns the attributes text of a class is drawn with. If nil,
+	// DefaultColors is used.
+	Colors func(c Class) (fg, bg termbox.Attribute)
+}
+
+func New(b *util.Buffer, lex Lexer) *Highlighter {
+	return &Highlighter{b: b, lex: lex}
+}
+
+// Class returns the class of the character at line, char.
+func (h *Highlighter) Class(line, char int) Class {
+	if line < 0 || line >= h.b.Nlines() {
+		return Plain
+	}
+	for l := len(h.lines); l <= line; l++ {
+		var st State
+		if l > 0 {
+			st = h.lines[l-1].end
+		}
+		classes, end := h.lex.Lex(h.b.Line(l), st)
+		h.lines = append(h.lines, lineInfo{classes, end})
+	}
+	if classes := h.lines[line].classes; char >= 0 && char < len(classes) {
+		return classes[char]
+	}
+	return Plain
+}
+
+func (h *Highlighter) Style(line, char int) (fg, bg termbox.Attribute) {
+	c := h.Class(line, char)
+	if h.Colors != nil {
+		return h.Colors(c)
+	}
+	return DefaultColors[c], 0
+}
+
+func (h *Highlighter) Invalidate(line int) {
+	if line < len(h.lines) {
+		h.lines = h.lines[:line]
+	}
+}
@@ -6,45 +6,83 @@ import (
 	"os"
 
 	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/config"
 	"github.com/rwcarlsen/editor/session"
+	"github.com/rwcarlsen/editor/theme"
 	"github.com/rwcarlsen/editor/view"
 )
 
-var flog *os.File
-var lg *log.Logger
+var logfile = flag.String("log", "", "append messages and errors to this file")
+var statefile = flag.String("state", session.DefaultStateFile(), "file to keep registers and search history in between sessions, or \"\" for none")
+var configfile = flag.String("config", config.DefaultPath(), "config file to read option settings from")
+
+// Flags that set options. Only those given on the command line are passed on
+// to the session, so that the rest can be set in the config file.
+func init() {
+	flag.Bool("backup", false, "keep the previous contents of saved files in file~")
+	flag.String("theme", "dark", "colour theme: a built in theme (dark, light), a theme in "+theme.Dir()+" or a theme file")
+	flag.Int("tabwidth", 4, "width of a tab stop")
+	flag.Bool("expandtab", false, "insert spaces instead of tabs")
+	flag.Bool("smartindent", true, "indent new lines like the previous one")
+	flag.Bool("number", true, "show line numbers")
+	flag.String("keymap", "vi", "key bindings: vi or emacs")
+}
 
 func main() {
 	flag.Parse()
 	log.SetFlags(0)
 
-	flog, err := os.Create("editor.log")
-	if err != nil {
-		log.Fatal(err)
+	var lg *log.Logger
+	if *logfile != "" {
+		f, err := os.OpenFile(*logfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		lg = log.New(f, "", log.LstdFlags)
 	}
-	defer flog.Close()
-	lg = log.New(flog, "", 0)
 
-	// start termbox
-	err = termbox.Init()
+	cfg, err := config.Load(*configfile)
 	if err != nil {
-		log.Print(err)
-		return
+		log.Fatal(err)
 	}
-	defer termbox.Close()
+	flags := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		if session.IsOption(f.Name) {
+			flags[f.Name] = f.Value.String()
+		}
+	})
 
 	v := &view.LineNum{View: &view.Wrap{}}
-	//v := &view.Wrap{}
 	s := &session.Session{
-		File:        flag.Arg(0),
 		View:        v,
 		ExpandTabs:  false,
 		SmartIndent: true,
 		Tabwidth:    4,
+		StateFile:   *statefile,
+		Config:      cfg,
+		Flags:       flags,
+		Log:         lg,
+	}
+
+	// read the file before starting termbox so that reading stdin ("-")
+	// finishes before the terminal is taken over.
+	if err := s.Open(flag.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+
+	// start termbox
+	if err := termbox.Init(); err != nil {
+		log.Fatal(err)
 	}
 
 	// run ...
 	err = s.Run()
+	termbox.Close()
 	if err != session.ErrQuit {
-		lg.Print(err)
+		if lg != nil {
+			lg.Print(err)
+		}
+		log.Fatal(err)
 	}
 }
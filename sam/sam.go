@@ -0,0 +1,546 @@
+// Package sam implements the command language of the sam and acme editors
+// on a util.Buffer.
+//
+// A command is an optional address followed by an action. Addresses are
+//
+//	#n      the empty range after the nth character
+//	n       line n
+//	/re/    the next match of re after dot, wrapping around
+//	?re?    the previous match of re before dot, wrapping around
+//	$       the empty range at the end of the buffer
+//	.       dot
+//	a1+a2   a2 evaluated forward from the end of a1 (a2 defaults to 1)
+//	a1-a2   a2 evaluated backward from the start of a1
+//	a1,a2   from the start of a1 to the end of a2 (defaults 0 and $)
+//	a1;a2   like a1,a2 but a2 is evaluated with dot set to a1
+//
+// and actions are
+//
+//	a/text/     append text after dot
+//	i/text/     insert text before dot
+//	c/text/     replace dot with text
+//	d           delete dot
+//	s/re/text/  replace the first match of re in dot, or all with a trailing g;
+//	            text may refer to submatches as in regexp.Expand
+//	|cmd        replace dot with its output piped through the shell command cmd
+//	x/re/ cmd   run cmd on every match of re in dot (every line if /re/ is
+//	            omitted)
+//	y/re/ cmd   run cmd on the text between matches of re in dot
+//	g/re/ cmd   run cmd on dot if it contains a match of re
+//	v/re/ cmd   run cmd on dot if it contains no match of re
+//
+// Any punctuation character may be used instead of '/'; it may be escaped
+// with a backslash, and \n in text stands for a newline.
+//
+// All edits a command makes refer to the buffer as it was before the command
+// ran. They are collected and returned rather than applied, so they must not
+// overlap.
+package sam
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rwcarlsen/editor/util"
+)
+
+// Range is the range of bytes [Start, End) in a buffer.
+type Range struct {
+	Start, End int
+}
+
+// Edit replaces a range of bytes with Text.
+type Edit struct {
+	Range
+	Text []byte
+}
+
+// IsCommand reports whether cmd begins like a sam command rather than an ex
+// command: with an address other than a line number, a pipe, one of the
+// actions a, i, c, x, y, g and v followed by a delimiter, or the action d.
+func IsCommand(cmd string) bool {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return false
+	}
+	switch cmd[0] {
+	case '#', '/', '?', ',', ';', '|':
+		return true
+	case 'a', 'i', 'c', 'x', 'y', 'g', 'v':
+		return len(cmd) > 1 && isDelim(cmd[1])
+	case 'd':
+		return len(cmd) == 1
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	return c < 0x80 && c != '\\' && c != '!' && c != ' ' && c != '\t' && c != '\n' &&
+		!('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9')
+}
+
+// Run runs cmd on b with dot as the current selection. It returns the edits
+// made, sorted by offset, and the new dot in the buffer as it will be once
+// the edits have been applied.
+func Run(b *util.Buffer, dot Range, cmd string) ([]Edit, Range, error) {
+	p := &parser{s: cmd}
+	c, err := p.cmd()
+	if err != nil {
+		return nil, dot, err
+	}
+	p.space()
+	if p.pos < len(p.s) {
+		return nil, dot, fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+
+	r := &runner{b: b, data: b.Bytes(), dot: dot, dotEdit: -1}
+	if err := r.run(c, dot); err != nil {
+		return nil, dot, err
+	}
+
+	edits := r.edits
+	order := make([]int, len(edits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return edits[order[i]].Start < edits[order[j]].Start })
+	sorted := make([]Edit, len(edits))
+	for i, n := range order {
+		sorted[i] = edits[n]
+		if i > 0 && sorted[i].Start < sorted[i-1].End {
+			return nil, dot, fmt.Errorf("changes not in sequence")
+		}
+	}
+
+	// move dot to where it will be after the edits
+	dot = r.dot
+	shift := 0
+	for _, n := range order {
+		e := edits[n]
+		if n == r.dotEdit {
+			return sorted, Range{e.Start + shift, e.Start + shift + len(e.Text)}, nil
+		} else if e.End > dot.Start {
+			break
+		}
+		shift += len(e.Text) - (e.End - e.Start)
+	}
+	return sorted, Range{dot.Start + shift, dot.End + shift}, nil
+}
+
+// addr is a parsed address.
+type addr struct {
+	kind        byte // one of "#l/?$.,;+-"
+	n           int
+	re          *regexp.Regexp
+	left, right *addr
+}
+
+// cmd is a parsed command.
+type cmd struct {
+	addr   *addr
+	name   byte // 0 for an address on its own
+	re     *regexp.Regexp
+	text   string
+	global bool // s with a trailing g
+	sub    *cmd // the command run by a loop
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) space() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) cmd() (*cmd, error) {
+	p.space()
+	a, err := p.compound()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	c := &cmd{addr: a, name: p.peek()}
+	if c.name == 0 {
+		return c, nil
+	}
+	p.pos++
+
+	switch c.name {
+	case 'a', 'i', 'c':
+		if c.text, err = p.delimited(true); err != nil {
+			return nil, err
+		}
+	case 'd':
+	case 's':
+		if c.re, err = p.regexp(); err != nil {
+			return nil, err
+		}
+		p.pos-- // the closing delimiter of the regexp opens the text
+		if c.text, err = p.delimited(true); err != nil {
+			return nil, err
+		}
+		if p.peek() == 'g' {
+			c.global = true
+			p.pos++
+		}
+	case '|':
+		c.text = strings.TrimSpace(p.s[p.pos:])
+		if c.text == "" {
+			return nil, fmt.Errorf("no command after |")
+		}
+		p.pos = len(p.s)
+	case 'x', 'y', 'g', 'v':
+		if isDelim(p.peek()) {
+			if c.re, err = p.regexp(); err != nil {
+				return nil, err
+			}
+		} else if c.name != 'x' {
+			return nil, fmt.Errorf("%c needs a regexp", c.name)
+		} else {
+			c.re = regexp.MustCompile(`(?m).*\n|.+$`)
+		}
+		if c.sub, err = p.cmd(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown command %q", c.name)
+	}
+	return c, nil
+}
+
+// compound parses an address made of simple addresses joined by ',' or ';'.
+func (p *parser) compound() (*addr, error) {
+	left, err := p.simple()
+	if err != nil {
+		return nil, err
+	}
+	if k := p.peek(); k == ',' || k == ';' {
+		p.pos++
+		right, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		return &addr{kind: k, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+// simple parses an address made of basic addresses joined by '+' or '-'.
+func (p *parser) simple() (*addr, error) {
+	a, err := p.basic()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		k := p.peek()
+		if k != '+' && k != '-' {
+			return a, nil
+		}
+		p.pos++
+		right, err := p.basic()
+		if err != nil {
+			return nil, err
+		}
+		a = &addr{kind: k, left: a, right: right}
+	}
+}
+
+// basic parses a single address, returning nil if there is none.
+func (p *parser) basic() (*addr, error) {
+	switch k := p.peek(); {
+	case k == '#':
+		p.pos++
+		n, ok := p.number()
+		if !ok {
+			return nil, fmt.Errorf("bad address: # needs a number")
+		}
+		return &addr{kind: '#', n: n}, nil
+	case '0' <= k && k <= '9':
+		n, _ := p.number()
+		return &addr{kind: 'l', n: n}, nil
+	case k == '/' || k == '?':
+		re, err := p.regexp()
+		if err != nil {
+			return nil, err
+		}
+		return &addr{kind: k, re: re}, nil
+	case k == '$' || k == '.':
+		p.pos++
+		return &addr{kind: k}, nil
+	}
+	return nil, nil
+}
+
+func (p *parser) number() (int, bool) {
+	start := p.pos
+	for p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	return n, err == nil
+}
+
+// delimited parses text enclosed in the delimiter at the current position.
+// The closing delimiter may be omitted at the end of the command. If text is
+// true, \n is replaced by a newline.
+func (p *parser) delimited(text bool) (string, error) {
+	if p.pos >= len(p.s) || !isDelim(p.s[p.pos]) {
+		return "", fmt.Errorf("missing delimiter")
+	}
+	delim := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for ; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		if c == delim {
+			p.pos++
+			return b.String(), nil
+		} else if c == '\\' && p.pos+1 < len(p.s) {
+			switch next := p.s[p.pos+1]; {
+			case next == delim:
+				b.WriteByte(delim)
+				p.pos++
+				continue
+			case next == 'n' && text:
+				b.WriteByte('\n')
+				p.pos++
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+func (p *parser) regexp() (*regexp.Regexp, error) {
+	s, err := p.delimited(false)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(s)
+}
+
+type runner struct {
+	b     *util.Buffer
+	data  []byte
+	edits []Edit
+	// dot is the range the last command ran on, or the index in edits of
+	// its edit if dotEdit is not -1.
+	dot     Range
+	dotEdit int
+}
+
+func (r *runner) run(c *cmd, dot Range) error {
+	dot, err := r.eval(c.addr, dot)
+	if err != nil {
+		return err
+	}
+	text := r.data[dot.Start:dot.End]
+
+	switch c.name {
+	case 0:
+		r.dot, r.dotEdit = dot, -1
+	case 'a':
+		r.edit(dot.End, dot.End, []byte(c.text))
+	case 'i':
+		r.edit(dot.Start, dot.Start, []byte(c.text))
+	case 'c':
+		r.edit(dot.Start, dot.End, []byte(c.text))
+	case 'd':
+		r.edit(dot.Start, dot.End, nil)
+	case 's':
+		n := 1
+		if c.global {
+			n = -1
+		}
+		for _, m := range c.re.FindAllSubmatchIndex(text, n) {
+			repl := c.re.Expand(nil, []byte(c.text), text, m)
+			r.edit(dot.Start+m[0], dot.Start+m[1], repl)
+		}
+	case '|':
+		cmd := exec.Command("sh", "-c", c.text)
+		cmd.Stdin = bytes.NewReader(text)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%v: %v", err, msg)
+			}
+			return err
+		}
+		r.edit(dot.Start, dot.End, out)
+	case 'x', 'y':
+		prev := dot.Start
+		for _, m := range c.re.FindAllIndex(text, -1) {
+			sub := Range{dot.Start + m[0], dot.Start + m[1]}
+			if c.name == 'y' {
+				sub = Range{prev, dot.Start + m[0]}
+				prev = dot.Start + m[1]
+			}
+			if err := r.run(c.sub, sub); err != nil {
+				return err
+			}
+		}
+		if c.name == 'y' {
+			return r.run(c.sub, Range{prev, dot.End})
+		}
+	case 'g', 'v':
+		if c.re.Match(text) == (c.name == 'g') {
+			return r.run(c.sub, dot)
+		}
+	}
+	return nil
+}
+
+func (r *runner) edit(start, end int, text []byte) {
+	r.edits = append(r.edits, Edit{Range{start, end}, text})
+	r.dot, r.dotEdit = Range{start, end}, len(r.edits)-1
+}
+
+func (r *runner) eval(a *addr, dot Range) (Range, error) {
+	if a == nil {
+		return dot, nil
+	}
+	size := len(r.data)
+	switch a.kind {
+	case '#':
+		if utf8.RuneCount(r.data) < a.n {
+			return dot, fmt.Errorf("address out of range: #%v", a.n)
+		}
+		_, end := r.b.Span(0, a.n)
+		return Range{end, end}, nil
+	case 'l':
+		return r.line(a.n)
+	case '/':
+		return r.search(a.re, dot.End, true)
+	case '?':
+		return r.search(a.re, dot.Start, false)
+	case '$':
+		return Range{size, size}, nil
+	case '.':
+		return dot, nil
+	case ',', ';':
+		left := Range{0, 0}
+		if a.left != nil {
+			var err error
+			if left, err = r.eval(a.left, dot); err != nil {
+				return dot, err
+			}
+		}
+		if a.kind == ';' {
+			dot = left
+		}
+		right := Range{size, size}
+		if a.right != nil {
+			var err error
+			if right, err = r.eval(a.right, dot); err != nil {
+				return dot, err
+			}
+		}
+		if left.Start > right.End {
+			return dot, fmt.Errorf("addresses out of order")
+		}
+		return Range{left.Start, right.End}, nil
+	case '+', '-':
+		left := dot
+		if a.left != nil {
+			var err error
+			if left, err = r.eval(a.left, dot); err != nil {
+				return dot, err
+			}
+		}
+		return r.relative(left, a.right, a.kind == '+')
+	}
+	panic("sam: bad address kind")
+}
+
+// relative evaluates a forward or backward from the end or start of dot.
+func (r *runner) relative(dot Range, a *addr, forward bool) (Range, error) {
+	if a == nil {
+		a = &addr{kind: 'l', n: 1}
+	}
+	switch a.kind {
+	case 'l':
+		var line int
+		if forward {
+			line, _ = r.b.Pos(util.Max(dot.End-1, dot.Start))
+			line += a.n
+		} else {
+			line, _ = r.b.Pos(dot.Start)
+			line -= a.n
+		}
+		return r.line(line + 1)
+	case '#':
+		if forward {
+			_, end := r.b.Span(dot.End, a.n)
+			return Range{end, end}, nil
+		}
+		start, _ := r.b.Span(dot.Start, -a.n)
+		return Range{start, start}, nil
+	case '/', '?':
+		if forward {
+			return r.search(a.re, dot.End, true)
+		}
+		return r.search(a.re, dot.Start, false)
+	}
+	return r.eval(a, dot)
+}
+
+// line returns the range of line n, counting from 1. Line 0 is the empty
+// range at the start of the buffer.
+func (r *runner) line(n int) (Range, error) {
+	if n == 0 {
+		return Range{0, 0}, nil
+	}
+	nlines := r.b.Nlines()
+	if n < 0 || n > nlines {
+		return Range{}, fmt.Errorf("address out of range: line %v", n)
+	}
+	start, end := r.b.Offset(n-1, 0), len(r.data)
+	if n < nlines {
+		end = r.b.Offset(n, 0)
+	}
+	return Range{start, end}, nil
+}
+
+// search finds the first match of re after offset, or the last one before it
+// if forward is false, wrapping around the ends of the buffer.
+func (r *runner) search(re *regexp.Regexp, offset int, forward bool) (Range, error) {
+	matches := re.FindAllIndex(r.data, -1)
+	if len(matches) == 0 {
+		return Range{}, fmt.Errorf("no match for %v", re)
+	}
+	if forward {
+		for _, m := range matches {
+			if m[0] >= offset {
+				return Range{m[0], m[1]}, nil
+			}
+		}
+		return Range{matches[0][0], matches[0][1]}, nil
+	}
+	for i := len(matches) - 1; i >= 0; i-- {
+		if m := matches[i]; m[1] <= offset {
+			return Range{m[0], m[1]}, nil
+		}
+	}
+	m := matches[len(matches)-1]
+	return Range{m[0], m[1]}, nil
+}
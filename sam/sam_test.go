@@ -0,0 +1,82 @@
+package sam
+
+import (
+	"testing"
+
+	"github.com/rwcarlsen/editor/util"
+)
+
+type samtest struct {
+	text   string
+	dot    Range
+	cmd    string
+	expect string
+	// expectdot is the text of dot after the command
+	expectdot string
+}
+
+var samtests = []samtest{
+	{"one\ntwo\nthree\n", Range{0, 0}, "2", "one\ntwo\nthree\n", "two\n"},
+	{"one\ntwo\nthree\n", Range{0, 0}, "2d", "one\nthree\n", ""},
+	{"one\ntwo\nthree\n", Range{0, 0}, "#4,#7c/2/", "one\n2\nthree\n", "2"},
+	{"one\ntwo\nthree\n", Range{0, 0}, "/t/", "one\ntwo\nthree\n", "t"},
+	{"one\ntwo\nthree\n", Range{0, 4}, "/t/,/e/", "one\ntwo\nthree\n", "two\nthre"},
+	{"one\ntwo\nthree\n", Range{8, 14}, "?o?", "one\ntwo\nthree\n", "o"},
+	{"one\ntwo\nthree\n", Range{0, 0}, "$-1", "one\ntwo\nthree\n", "three\n"},
+	{"one\ntwo\nthree\n", Range{4, 8}, ".+1i/>/", "one\ntwo\n>three\n", ">"},
+	{"one\ntwo\nthree\n", Range{4, 8}, ".-1a/</", "one\n<two\nthree\n", "<"},
+	{"one\ntwo\nthree\n", Range{0, 0}, "1;+1", "one\ntwo\nthree\n", "one\ntwo\n"},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",x/o/c/0/", "0ne\ntw0\nthree\n", "0"},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",x/t.*/ s/(t)(.)/$2$1/", "one\nwto\nhtree\n", "ht"},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",x g/e/ d", "two\n", ""},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",x v/e/ d", "one\nthree\n", ""},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",y/\\n/ i/- /", "- one\n- two\n- three\n- ", "- "},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",s/e/E/g", "onE\ntwo\nthrEE\n", "E"},
+	{"one\ntwo\nthree\n", Range{0, 0}, ",s/e/E/", "onE\ntwo\nthree\n", "E"},
+	{"a,b\n", Range{0, 0}, ",x/,/c/\\n/", "a\nb\n", "\n"},
+	{"one\ntwo\n", Range{0, 0}, ",|tr a-z A-Z", "ONE\nTWO\n", "ONE\nTWO\n"},
+	{"héllo wörld\n", Range{0, 0}, "#1,#4d", "ho wörld\n", ""},
+}
+
+func TestRun(t *testing.T) {
+	for i, test := range samtests {
+		b := util.NewBuffer([]byte(test.text))
+		edits, dot, err := Run(b, test.dot, test.cmd)
+		if err != nil {
+			t.Errorf("test %v (%q): %v", i, test.cmd, err)
+			continue
+		}
+		for j := len(edits) - 1; j >= 0; j-- {
+			b.Replace(edits[j].Start, edits[j].End, edits[j].Text)
+		}
+		if got := string(b.Bytes()); got != test.expect {
+			t.Errorf("test %v (%q): expected %q, got %q", i, test.cmd, test.expect, got)
+		} else if got := string(b.Slice(dot.Start, dot.End)); got != test.expectdot {
+			t.Errorf("test %v (%q): expected dot %q, got %q", i, test.cmd, test.expectdot, got)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	cmds := []string{"5", "#100", "/nomatch/", "2,#1", ",x/o/ ,d", "q", ",x/(/d", "g d"}
+	for _, cmd := range cmds {
+		b := util.NewBuffer([]byte("one\ntwo\n"))
+		if _, _, err := Run(b, Range{}, cmd); err == nil {
+			t.Errorf("%q: expected an error", cmd)
+		}
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	tests := map[string]bool{
+		",x/a/d": true, "/foo/d": true, "#3": true, "| sort": true,
+		"d": true, " d ": true, "a/x/": true, "x/a/ c/b/": true,
+		"": false, "x": false, "w": false, "wq": false, "q": false,
+		"set tw=4": false, "s/a/b/": false, "delete": false, "e file": false,
+	}
+	for cmd, expect := range tests {
+		if got := IsCommand(cmd); got != expect {
+			t.Errorf("IsCommand(%q): expected %v, got %v", cmd, expect, got)
+		}
+	}
+}
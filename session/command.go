@@ -0,0 +1,400 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/sam"
+	"github.com/rwcarlsen/editor/theme"
+)
+
+// exCommand runs a command typed on the command line. arg is the text after
+// the command name and bang is true if the name was followed by a '!'.
+type exCommand func(s *Session, arg string, bang bool) error
+
+var exCommands = map[string]exCommand{
+	"w":          cmdWrite,
+	"write":      cmdWrite,
+	"q":          cmdQuit,
+	"quit":       cmdQuit,
+	"wq":         cmdWriteQuit,
+	"x":          cmdWriteQuit,
+	"e":          cmdEdit,
+	"edit":       cmdEdit,
+	"saveas":     cmdSaveas,
+	"set":        cmdSet,
+	"theme":      cmdTheme,
+	"messages":   cmdMessages,
+	"noh":        cmdNohlsearch,
+	"nohlsearch": cmdNohlsearch,
+	"map":        mapCommand("edit"),
+	"unmap":      unmapCommand("edit"),
+	"vmap":       mapCommand("visual"),
+	"vunmap":     unmapCommand("visual"),
+	"imap":       mapCommand("insert"),
+	"iunmap":     unmapCommand("insert"),
+	"emap":       mapCommand("emacs"),
+	"eunmap":     unmapCommand("emacs"),
+	"omap":       mapCommand("object"),
+	"ounmap":     unmapCommand("object"),
+}
+
+// fileArgs lists the commands whose argument is a file name.
+var fileArgs = map[string]bool{
+	"w": true, "write": true, "wq": true, "x": true,
+	"e": true, "edit": true, "saveas": true,
+}
+
+func cmdWrite(s *Session, arg string, bang bool) error {
+	if arg == "" {
+		arg = s.File
+	}
+	if arg == "" {
+		return fmt.Errorf("no file name")
+	}
+	if err := s.Save(arg); err != nil {
+		return err
+	}
+	s.Info("%q written", arg)
+	return nil
+}
+
+func cmdQuit(s *Session, arg string, bang bool) error {
+	if err := s.Quit(bang); err != ErrQuit {
+		return fmt.Errorf("%v (add ! to override)", err)
+	}
+	return ErrQuit
+}
+
+func cmdWriteQuit(s *Session, arg string, bang bool) error {
+	if err := cmdWrite(s, arg, bang); err != nil {
+		return err
+	}
+	return ErrQuit
+}
+
+func cmdEdit(s *Session, arg string, bang bool) error {
+	if arg == "" {
+		arg = s.File
+	}
+	if s.Dirty() && !bang {
+		return fmt.Errorf("no write since last change (add ! to override)")
+	}
+	return s.Open(arg)
+}
+
+func cmdSaveas(s *Session, arg string, bang bool) error {
+	if arg == "" {
+		return fmt.Errorf("no file name")
+	}
+	old := s.File
+	s.File = arg
+	if err := cmdWrite(s, arg, bang); err != nil {
+		s.File = old
+		return err
+	}
+	return nil
+}
+
+func cmdTheme(s *Session, arg string, bang bool) error {
+	if arg == "" {
+		name := theme.Default.Name
+		if s.Theme != nil {
+			name = s.Theme.Name
+		}
+		s.Info("%v", name)
+		return nil
+	}
+	t, err := theme.Load(arg)
+	if err != nil {
+		return err
+	}
+	s.SetTheme(t)
+	return nil
+}
+
+func cmdNohlsearch(s *Session, arg string, bang bool) error {
+	s.nohl = true
+	return nil
+}
+
+// rangeCommand is a command that acts on the lines first to last.
+type rangeCommand func(s *Session, first, last int, arg string, bang bool) error
+
+var rangeCommands = map[string]rangeCommand{
+	"s":          cmdSubstitute,
+	"substitute": cmdSubstitute,
+}
+
+// ExecCommand runs the command line cmd. Commands may be preceded by a line
+// range; a range on its own moves the cursor to its last line. Sam commands
+// (see package sam) run with dot set to the range, or the cursor line.
+func (s *Session) ExecCommand(cmd string) error {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return nil
+	}
+	first, last, rest, err := s.parseRange(cmd)
+	if err != nil {
+		return err
+	}
+	hasRange := rest != cmd
+	if sam.IsCommand(rest) {
+		return s.execSam(rest, first, last)
+	}
+
+	name, arg, bang := parseCommand(strings.TrimSpace(rest))
+	if name == "" && hasRange && arg == "" {
+		s.SetCursor(last, 0)
+		return nil
+	}
+	if fn, ok := rangeCommands[name]; ok {
+		if !hasRange {
+			first, last = s.CursorL, s.CursorL
+		}
+		if first < 0 || last >= s.Buf.Nlines() {
+			return fmt.Errorf("invalid range")
+		}
+		return fn(s, first, last, arg, bang)
+	}
+	fn, ok := exCommands[name]
+	if !ok {
+		return fmt.Errorf("not an editor command: %v", cmd)
+	} else if hasRange {
+		return fmt.Errorf("no range allowed: %v", name)
+	}
+	return fn(s, arg, bang)
+}
+
+// execSam runs the sam command cmd with dot set to the lines first to last
+// and moves the cursor to the start of the resulting dot. The edits it makes
+// are undone as one change.
+func (s *Session) execSam(cmd string, first, last int) error {
+	start, end := s.lineRange(first, last)
+	edits, dot, err := sam.Run(s.Buf, sam.Range{Start: start, End: end}, cmd)
+	if err != nil {
+		return err
+	}
+	if len(edits) > 0 {
+		subs := make([]substitution, len(edits))
+		for i, e := range edits {
+			subs[i] = substitution{e.Start, e.End, e.Text}
+		}
+		s.replaceAll(subs)
+	}
+	s.SetCursor(s.Buf.Pos(dot.Start))
+	return nil
+}
+
+// lineRange returns the byte range covering the lines first to last and
+// their newlines.
+func (s *Session) lineRange(first, last int) (start, end int) {
+	start, end = s.Buf.Offset(first, 0), s.Buf.Len()
+	if last+1 < s.Buf.Nlines() {
+		end = s.Buf.Offset(last+1, 0)
+	}
+	return start, end
+}
+
+// parseRange parses the line range at the start of cmd: "%" for the whole
+// buffer, or one or two comma separated addresses. It returns the first and
+// last lines of the range and the rest of cmd.
+func (s *Session) parseRange(cmd string) (first, last int, rest string, err error) {
+	if strings.HasPrefix(cmd, "%") {
+		return 0, s.Buf.Nlines() - 1, cmd[1:], nil
+	}
+	first, rest, ok := s.parseAddr(cmd)
+	if !ok {
+		return s.CursorL, s.CursorL, cmd, nil
+	}
+	last = first
+	if strings.HasPrefix(rest, ",") {
+		if last, rest, ok = s.parseAddr(rest[1:]); !ok {
+			return 0, 0, "", fmt.Errorf("invalid range: %v", cmd)
+		}
+	}
+	if first > last {
+		first, last = last, first
+	}
+	return first, last, rest, nil
+}
+
+// parseAddr parses a line address at the start of cmd: a line number, "."
+// for the cursor line or "$" for the last line, followed by any number of
+// +n or -n offsets.
+func (s *Session) parseAddr(cmd string) (line int, rest string, ok bool) {
+	switch {
+	case strings.HasPrefix(cmd, "."):
+		line, rest = s.CursorL, cmd[1:]
+	case strings.HasPrefix(cmd, "$"):
+		line, rest = s.Buf.Nlines()-1, cmd[1:]
+	default:
+		n, r := leadingNumber(cmd)
+		if r == cmd {
+			if !strings.HasPrefix(cmd, "+") && !strings.HasPrefix(cmd, "-") {
+				return 0, cmd, false
+			}
+			n = s.CursorL + 1
+		}
+		line, rest = n-1, r
+	}
+	for len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+		n, r := leadingNumber(rest[1:])
+		if r == rest[1:] {
+			n = 1
+		}
+		if rest[0] == '-' {
+			n = -n
+		}
+		line, rest = line+n, r
+	}
+	return line, rest, true
+}
+
+// leadingNumber parses the decimal number at the start of str. If there is
+// none, rest is str.
+func leadingNumber(str string) (n int, rest string) {
+	i := strings.IndexFunc(str, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(str)
+	}
+	n, err := strconv.Atoi(str[:i])
+	if err != nil {
+		return 0, str
+	}
+	return n, str[i:]
+}
+
+// parseCommand splits a command line into the command name, its argument and
+// whether the name was followed by a '!'.
+func parseCommand(cmd string) (name, arg string, bang bool) {
+	i := strings.IndexFunc(cmd, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i == -1 {
+		return cmd, "", false
+	}
+	name, arg = cmd[:i], cmd[i:]
+	if strings.HasPrefix(arg, "!") {
+		bang, arg = true, arg[1:]
+	}
+	return name, strings.TrimSpace(arg), bang
+}
+
+// ModeCommand reads a command line and runs it with ExecCommand on Enter.
+// Tab completes command names and file name arguments.
+type ModeCommand struct {
+	p *prompt
+	// completions being cycled through by repeated tab presses
+	completions []string
+	ncomplete   int
+}
+
+func (m *ModeCommand) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	if m.p == nil {
+		m.p = newPrompt(s, ':')
+	}
+	if ev.Key != termbox.KeyTab {
+		m.completions = nil
+	}
+	if m.p.handleKey(ev) {
+		return m, nil
+	}
+
+	switch ev.Key {
+	case termbox.KeyEnter:
+		err := s.ExecCommand(m.p.text())
+		if err == ErrQuit {
+			return m, err
+		} else if err != nil {
+			s.Error("%v", err)
+		}
+		if s.mode != m {
+			// the command switched modes itself
+			return s.mode, nil
+		}
+		return s.baseMode(), nil
+	case termbox.KeyTab:
+		m.complete()
+	case termbox.KeyEsc:
+		return s.baseMode(), nil
+	}
+	return m, nil
+}
+
+func (m *ModeCommand) draw(s *Session) {
+	if m.p == nil {
+		m.p = newPrompt(s, ':')
+	}
+	m.p.draw(s)
+}
+
+// complete replaces the prompt text with the next completion of the text
+// typed before the first tab press.
+func (m *ModeCommand) complete() {
+	if m.completions == nil {
+		m.completions = completions(m.p.text())
+		m.ncomplete = 0
+	}
+	if len(m.completions) == 0 {
+		return
+	}
+	m.p.setText(m.completions[m.ncomplete%len(m.completions)])
+	m.ncomplete++
+}
+
+// completions returns the possible completions of a partial command line.
+func completions(cmd string) []string {
+	name, arg, bang := parseCommand(cmd)
+	if !strings.ContainsAny(cmd, " !") {
+		var names []string
+		for n := range exCommands {
+			if strings.HasPrefix(n, name) {
+				names = append(names, n)
+			}
+		}
+		for n := range rangeCommands {
+			if strings.HasPrefix(n, name) {
+				names = append(names, n)
+			}
+		}
+		sort.Strings(names)
+		return names
+	} else if name == "theme" {
+		var names []string
+		for _, n := range theme.Names() {
+			if strings.HasPrefix(n, arg) {
+				names = append(names, name+" "+n)
+			}
+		}
+		return names
+	} else if name == "set" {
+		i := strings.LastIndex(arg, " ") + 1
+		var names []string
+		for _, opt := range options {
+			if strings.HasPrefix(opt.name, arg[i:]) {
+				names = append(names, name+" "+arg[:i]+opt.name)
+			}
+		}
+		return names
+	} else if !fileArgs[name] {
+		return nil
+	}
+
+	paths, _ := filepath.Glob(arg + "*")
+	prefix := name + " "
+	if bang {
+		prefix = name + "! "
+	}
+	for i, path := range paths {
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			path += string(filepath.Separator)
+		}
+		paths[i] = prefix + path
+	}
+	return paths
+}
@@ -0,0 +1,226 @@
+package session
+
+import (
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// ModeEmacs is a modeless alternative to the vi-like modes with Emacs-like
+// bindings from the "emacs" keymap. Keys that are not bound insert
+// themselves.
+type ModeEmacs struct {
+	keys []string // pending keys of a multi-key sequence such as C-x C-s
+	// typing is true while a run of typed characters is being grouped
+	// into one undoable change.
+	typing bool
+	// killed is true if the last command killed text, in which case the
+	// next kill is appended to it.
+	killed bool
+	// quitArmed is true if the last command was a refused quit.
+	quitArmed bool
+}
+
+// emacsCommand is an action of the emacs keymap. It returns the mode to
+// switch to, or nil to stay in emacs mode.
+type emacsCommand func(m *ModeEmacs, s *Session) (Mode, error)
+
+var emacsCommands = map[string]emacsCommand{
+	"forward-char": func(m *ModeEmacs, s *Session) (Mode, error) {
+		offset := s.Buf.Offset(s.CursorL, s.CursorC)
+		_, size := s.Buf.RuneAt(offset)
+		s.SetCursor(s.Buf.Pos(offset + size))
+		return nil, nil
+	},
+	"backward-char": func(m *ModeEmacs, s *Session) (Mode, error) {
+		offset := s.Buf.Offset(s.CursorL, s.CursorC)
+		_, size := s.Buf.RuneBefore(offset)
+		s.SetCursor(s.Buf.Pos(offset - size))
+		return nil, nil
+	},
+	"next-line": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.SetCursor(s.CursorL+1, -1)
+		return nil, nil
+	},
+	"previous-line": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.SetCursor(s.CursorL-1, -1)
+		return nil, nil
+	},
+	"line-start": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.SetCursor(-1, 0)
+		return nil, nil
+	},
+	"line-end": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.SetCursor(-1, len(s.Buf.Line(s.CursorL))-1)
+		return nil, nil
+	},
+	"forward-word": func(m *ModeEmacs, s *Session) (Mode, error) {
+		offset := s.Buf.Offset(s.CursorL, s.CursorC)
+		s.SetCursor(s.Buf.Pos(skipWord(s, skipNonWord(s, offset, 1), 1)))
+		return nil, nil
+	},
+	"backward-word": func(m *ModeEmacs, s *Session) (Mode, error) {
+		offset := s.Buf.Offset(s.CursorL, s.CursorC)
+		s.SetCursor(s.Buf.Pos(skipWord(s, skipNonWord(s, offset, -1), -1)))
+		return nil, nil
+	},
+	"newline": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.Insert('\n')
+		return nil, nil
+	},
+	"tab": func(m *ModeEmacs, s *Session) (Mode, error) {
+		if s.ExpandTabs {
+			s.Insert([]rune(strings.Repeat(" ", s.Tabwidth))...)
+		} else {
+			s.Insert('\t')
+		}
+		return nil, nil
+	},
+	"delete-char": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.Delete(1)
+		return nil, nil
+	},
+	"delete-backward-char": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.Delete(-1)
+		return nil, nil
+	},
+	"kill-line": func(m *ModeEmacs, s *Session) (Mode, error) {
+		// kill to the end of the line, or the newline itself if the
+		// cursor is already there.
+		line := s.Buf.Line(s.CursorL)
+		n := len(line) - 1 - s.CursorC
+		if n <= 0 {
+			n = 1
+		}
+		offset := s.Buf.Offset(s.CursorL, s.CursorC)
+		start, end := s.Buf.Span(offset, n)
+		text := s.Buf.Slice(start, end)
+		if m.killed && s.Regs[Unnamed] != nil {
+			text = append(append([]byte{}, s.Regs[Unnamed].Text...), text...)
+		}
+		s.Yank(text, false)
+		s.Delete(n)
+		m.killed = true
+		return nil, nil
+	},
+	"yank": func(m *ModeEmacs, s *Session) (Mode, error) {
+		if reg := s.Regs[Unnamed]; reg != nil {
+			s.Insert([]rune(string(reg.Text))...)
+		}
+		return nil, nil
+	},
+	"undo": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.Undo()
+		return nil, nil
+	},
+	"isearch": func(m *ModeEmacs, s *Session) (Mode, error) {
+		return &ModeSearch{again: termbox.KeyCtrlS}, nil
+	},
+	"isearch-backward": func(m *ModeEmacs, s *Session) (Mode, error) {
+		return &ModeSearch{back: true, again: termbox.KeyCtrlR}, nil
+	},
+	"command": func(m *ModeEmacs, s *Session) (Mode, error) {
+		return &ModeCommand{}, nil
+	},
+	"save": func(m *ModeEmacs, s *Session) (Mode, error) {
+		s.ctrlS()
+		return nil, nil
+	},
+	"quit": func(m *ModeEmacs, s *Session) (Mode, error) {
+		err := s.Quit(m.quitArmed)
+		if err != ErrQuit {
+			s.Warn("%v (quit again to discard changes)", err)
+			m.quitArmed = true
+			return nil, nil
+		}
+		return nil, err
+	},
+}
+
+func (m *ModeEmacs) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	name := keyName(ev)
+	if name == "" {
+		return m, nil
+	} else if ev.Key == termbox.KeyCtrlG && ev.Ch == 0 {
+		if m.typing {
+			s.EndGroup()
+		}
+		m.keys, m.typing, m.killed, m.quitArmed = nil, false, false, false
+		s.Info("Quit")
+		return m, nil
+	}
+
+	m.keys = append(m.keys, name)
+	action, prefix := s.keymap("emacs").Lookup(m.keys)
+	if action == "" && prefix {
+		return m, nil
+	}
+	keys := m.keys
+	m.keys = nil
+
+	killed, quitArmed := m.killed, m.quitArmed
+	m.killed, m.quitArmed = false, false
+	if action == "" && len(keys) == 1 && (ev.Ch != 0 || ev.Key == termbox.KeySpace) && ev.Mod&termbox.ModAlt == 0 {
+		if !m.typing {
+			s.StartGroup()
+			m.typing = true
+		}
+		if ev.Ch != 0 {
+			s.Insert(ev.Ch)
+		} else {
+			s.Insert(' ')
+		}
+		return m, nil
+	}
+	if m.typing {
+		s.EndGroup()
+		m.typing = false
+	}
+
+	if action == "" {
+		s.Warn("%v is undefined", joinKeys(keys))
+		return m, nil
+	}
+	m.killed = killed && action == "kill-line"
+	m.quitArmed = quitArmed && action == "quit"
+	next, err := emacsCommands[action](m, s)
+	return orMode(next, m), err
+}
+
+// joinKeys returns the key sequence made of keys in Emacs notation, e.g.
+// "C-x C-s".
+func joinKeys(keys []string) string {
+	var names []string
+	for _, k := range keys {
+		if len(k) > 2 && k[0] == '<' {
+			k = k[1 : len(k)-1]
+		}
+		names = append(names, k)
+	}
+	return strings.Join(names, " ")
+}
+
+// skipNonWord returns the offset after (dir > 0) or before (dir < 0) the
+// non-word characters following or preceding offset.
+func skipNonWord(s *Session, offset, dir int) int {
+	return skipWhile(s, offset, dir, func(r rune) bool { return !isWordRune(r) })
+}
+
+// skipWord is like skipNonWord for word characters.
+func skipWord(s *Session, offset, dir int) int {
+	return skipWhile(s, offset, dir, isWordRune)
+}
+
+func skipWhile(s *Session, offset, dir int, f func(rune) bool) int {
+	for {
+		r, size := s.Buf.RuneAt(offset)
+		if dir < 0 {
+			r, size = s.Buf.RuneBefore(offset)
+			size = -size
+		}
+		if size == 0 || !f(r) {
+			return offset
+		}
+		offset += size
+	}
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var charsets = map[string]bool{"": true, "utf-8": true, "utf-8-bom": true, "latin1": true, "utf-16le": true, "utf-16be": true}
+
+var eols = map[string]string{"": "", "lf": "\n", "crlf": "\r\n", "cr": "\r"}
+
+const bom = "\ufeff"
+
+// decode converts file contents in the given charset and line ending to the
+// UTF-8, newline terminated text the buffer holds. Empty names leave data
+// alone.
+func decode(data []byte, charset, eol string) ([]byte, error) {
+	switch charset {
+	case "utf-8-bom":
+		data = bytes.TrimPrefix(data, []byte(bom))
+	case "latin1":
+		var b bytes.Buffer
+		for _, c := range data {
+			b.WriteRune(rune(c))
+		}
+		data = b.Bytes()
+	case "utf-16le", "utf-16be":
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("invalid %v: odd number of bytes", charset)
+		}
+		order := binary.ByteOrder(binary.LittleEndian)
+		if charset == "utf-16be" {
+			order = binary.BigEndian
+		}
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = order.Uint16(data[2*i:])
+		}
+		if len(u) > 0 && u[0] == 0xfeff {
+			u = u[1:]
+		}
+		data = []byte(string(utf16.Decode(u)))
+	}
+
+	if eol != "" {
+		data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	}
+	if eol == "cr" {
+		data = bytes.Replace(data, []byte("\r"), []byte("\n"), -1)
+	}
+	return data, nil
+}
+
+// encode is the inverse of decode.
+func encode(data []byte, charset, eol string) ([]byte, error) {
+	if eol != "" {
+		data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+		data = bytes.Replace(data, []byte("\n"), []byte(eols[eol]), -1)
+	}
+
+	switch charset {
+	case "utf-8-bom":
+		data = append([]byte(bom), data...)
+	case "latin1":
+		var b bytes.Buffer
+		for len(data) > 0 {
+			r, n := utf8.DecodeRune(data)
+			if r > 0xff {
+				return nil, fmt.Errorf("cannot encode %q in latin1", r)
+			}
+			b.WriteByte(byte(r))
+			data = data[n:]
+		}
+		data = b.Bytes()
+	case "utf-16le", "utf-16be":
+		order := binary.ByteOrder(binary.LittleEndian)
+		if charset == "utf-16be" {
+			order = binary.BigEndian
+		}
+		u := utf16.Encode(bytes.Runes(data))
+		b := make([]byte, 2*len(u))
+		for i, c := range u {
+			order.PutUint16(b[2*i:], c)
+		}
+		data = b
+	}
+	return data, nil
+}
+
+var trailingSpace = regexp.MustCompile(`(?m)[ \t]+$`)
+
+// whitespaceFixes returns the substitutions that remove trailing whitespace
+// from the lines of data if TrimSpace is set and add a missing final newline
+// if FinalNewline is set.
+func (s *Session) whitespaceFixes(data []byte) []substitution {
+	var subs []substitution
+	if s.TrimSpace {
+		for _, m := range trailingSpace.FindAllIndex(data, -1) {
+			subs = append(subs, substitution{m[0], m[1], nil})
+		}
+	}
+	if n := len(data); s.FinalNewline && n > 0 && data[n-1] != '\n' {
+		subs = append(subs, substitution{n, n, []byte("\n")})
+	}
+	return subs
+}
+
+// fixWhitespace makes the whitespaceFixes to the buffer. The changes can be
+// undone as one.
+func (s *Session) fixWhitespace() {
+	subs := s.whitespaceFixes(s.Buf.Bytes())
+	if len(subs) == 0 {
+		return
+	}
+
+	l, c := s.CursorL, s.CursorC
+	s.StartGroup()
+	s.replaceAll(subs)
+	s.EndGroup()
+	s.SetCursor(l, c)
+}
+
+// fixedWhitespace returns a copy of data with the whitespaceFixes made.
+func (s *Session) fixedWhitespace(data []byte) []byte {
+	var b []byte
+	prev := 0
+	for _, sub := range s.whitespaceFixes(data) {
+		b = append(append(b, data[prev:sub.start]...), sub.text...)
+		prev = sub.end
+	}
+	return append(b, data[prev:]...)
+}
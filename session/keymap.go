@@ -0,0 +1,455 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Keys are named like in vi: printable characters stand for themselves and
+// other keys are written in angle brackets, e.g. <CR>, <Esc>, <C-r> (Ctrl-R)
+// and <M-f> (Alt-F). A key sequence is a string of keys such as "gg" or
+// "<C-x><C-s>".
+
+var keyNames = map[termbox.Key]string{
+	termbox.KeyEnter:          "<CR>",
+	termbox.KeyEsc:            "<Esc>",
+	termbox.KeyTab:            "<Tab>",
+	termbox.KeySpace:          "<Space>",
+	termbox.KeyBackspace:      "<BS>",
+	termbox.KeyBackspace2:     "<BS>",
+	termbox.KeyDelete:         "<Del>",
+	termbox.KeyInsert:         "<Insert>",
+	termbox.KeyHome:           "<Home>",
+	termbox.KeyEnd:            "<End>",
+	termbox.KeyPgup:           "<PageUp>",
+	termbox.KeyPgdn:           "<PageDown>",
+	termbox.KeyArrowUp:        "<Up>",
+	termbox.KeyArrowDown:      "<Down>",
+	termbox.KeyArrowLeft:      "<Left>",
+	termbox.KeyArrowRight:     "<Right>",
+	termbox.KeyCtrlSpace:      "<C-Space>",
+	termbox.KeyCtrlUnderscore: "<C-_>",
+	termbox.KeyF1:             "<F1>",
+	termbox.KeyF2:             "<F2>",
+	termbox.KeyF3:             "<F3>",
+	termbox.KeyF4:             "<F4>",
+	termbox.KeyF5:             "<F5>",
+	termbox.KeyF6:             "<F6>",
+	termbox.KeyF7:             "<F7>",
+	termbox.KeyF8:             "<F8>",
+	termbox.KeyF9:             "<F9>",
+	termbox.KeyF10:            "<F10>",
+	termbox.KeyF11:            "<F11>",
+	termbox.KeyF12:            "<F12>",
+}
+
+func init() {
+	// Ctrl-H, Ctrl-I, Ctrl-M and Ctrl-[ are the same as <BS>, <Tab>, <CR>
+	// and <Esc> and keep those names.
+	for k := termbox.KeyCtrlA; k <= termbox.KeyCtrlZ; k++ {
+		if _, ok := keyNames[k]; !ok {
+			keyNames[k] = fmt.Sprintf("<C-%c>", 'a'+rune(k-termbox.KeyCtrlA))
+		}
+	}
+}
+
+// keyName returns the name of the key pressed in ev.
+func keyName(ev termbox.Event) string {
+	name := string(ev.Ch)
+	if ev.Ch == 0 {
+		name = keyNames[ev.Key]
+	} else if ev.Ch == ' ' {
+		name = "<Space>"
+	} else if ev.Ch == '<' {
+		name = "<lt>"
+	}
+	if ev.Mod&termbox.ModAlt != 0 && name != "" {
+		name = "<M-" + strings.TrimSuffix(strings.TrimPrefix(name, "<"), ">") + ">"
+	}
+	return name
+}
+
+// lookup looks keys up in the keymaps of modes in turn and returns the
+// result from the first where they are bound or start a binding.
+func (s *Session) lookup(keys []string, modes ...string) (action string, prefix bool) {
+	for _, mode := range modes {
+		if action, prefix = s.keymap(mode).Lookup(keys); action != "" || prefix {
+			break
+		}
+	}
+	return action, prefix
+}
+
+// typedChar returns the character typed in ev, or 0 if ev is not a
+// character without modifiers.
+func typedChar(ev termbox.Event) rune {
+	if ev.Mod&termbox.ModAlt != 0 {
+		return 0
+	} else if ev.Ch != 0 {
+		return ev.Ch
+	}
+	switch ev.Key {
+	case termbox.KeySpace:
+		return ' '
+	case termbox.KeyTab:
+		return '\t'
+	}
+	return 0
+}
+
+// parseKeys splits a key sequence into the names of its keys, normalizing
+// the case of bracketed names.
+func parseKeys(seq string) ([]string, error) {
+	var keys []string
+	for seq != "" {
+		if seq[0] != '<' || !strings.Contains(seq, ">") || seq == "<" {
+			r, size := utf8.DecodeRuneInString(seq)
+			keys = append(keys, keyName(termbox.Event{Ch: r}))
+			seq = seq[size:]
+			continue
+		}
+		i := strings.Index(seq, ">")
+		name, err := normalizeKey(seq[1:i])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, name)
+		seq = seq[i+1:]
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	return keys, nil
+}
+
+// normalizeKey returns the name of the key written inside angle brackets as
+// s, e.g. "c-R" gives "<C-r>".
+func normalizeKey(s string) (string, error) {
+	alt := len(s) > 2 && strings.EqualFold(s[:2], "m-")
+	if alt {
+		s = s[2:]
+	}
+	name := ""
+	if r, size := utf8.DecodeRuneInString(s); size == len(s) {
+		name = keyName(termbox.Event{Ch: r})
+	} else if strings.EqualFold(s, "lt") {
+		name = "<lt>"
+	} else {
+		for _, n := range keyNames {
+			if strings.EqualFold(n, "<"+s+">") {
+				name = n
+			}
+		}
+	}
+	if name == "" {
+		return "", fmt.Errorf("unknown key <%v>", s)
+	}
+	if alt {
+		name = "<M-" + strings.TrimSuffix(strings.TrimPrefix(name, "<"), ">") + ">"
+	}
+	return name, nil
+}
+
+// Keymap maps key sequences to the names of actions.
+type Keymap struct {
+	root keyNode
+}
+
+type keyNode struct {
+	action string
+	next   map[string]*keyNode
+}
+
+// Map binds the key sequence keys to action.
+func (k *Keymap) Map(keys []string, action string) {
+	n := &k.root
+	for _, key := range keys {
+		if n.next == nil {
+			n.next = map[string]*keyNode{}
+		}
+		if n.next[key] == nil {
+			n.next[key] = &keyNode{}
+		}
+		n = n.next[key]
+	}
+	n.action = action
+}
+
+// Unmap removes the binding of keys and returns false if there was none.
+func (k *Keymap) Unmap(keys []string) bool {
+	n := &k.root
+	for _, key := range keys {
+		if n = n.next[key]; n == nil {
+			return false
+		}
+	}
+	had := n.action != ""
+	n.action = ""
+	return had
+}
+
+// Lookup returns the action bound to keys, if any, and whether keys is the
+// beginning of a longer bound sequence.
+func (k *Keymap) Lookup(keys []string) (action string, prefix bool) {
+	n := &k.root
+	for _, key := range keys {
+		if n = n.next[key]; n == nil {
+			return "", false
+		}
+	}
+	return n.action, n.hasBindings()
+}
+
+func (n *keyNode) hasBindings() bool {
+	for _, next := range n.next {
+		if next.action != "" || next.hasBindings() {
+			return true
+		}
+	}
+	return false
+}
+
+// Bindings returns the bound key sequences and their actions, sorted by key
+// sequence.
+func (k *Keymap) Bindings() [][2]string {
+	var b [][2]string
+	var walk func(n *keyNode, seq string)
+	walk = func(n *keyNode, seq string) {
+		if n.action != "" {
+			b = append(b, [2]string{seq, n.action})
+		}
+		for key, next := range n.next {
+			walk(next, seq+key)
+		}
+	}
+	walk(&k.root, "")
+	sort.Slice(b, func(i, j int) bool { return b[i][0] < b[j][0] })
+	return b
+}
+
+// keymapDef describes the keymap of a mode: its default bindings and the
+// actions that can be bound in it.
+type keymapDef struct {
+	defaults map[string]string
+	valid    func(action string) bool
+}
+
+var motionKeys = map[string]string{
+	"h": "left", "<Left>": "left", "<BS>": "left",
+	"l": "right", "<Right>": "right", "<Space>": "right",
+	"j": "down", "<Down>": "down", "<CR>": "down",
+	"k": "up", "<Up>": "up",
+	"w": "word", "b": "word-back", "e": "word-end",
+	"W": "bigword", "B": "bigword-back", "E": "bigword-end",
+	"}": "paragraph", "{": "paragraph-back", "%": "match-bracket",
+	"0": "line-start", "^": "first-non-blank", "$": "line-end",
+	"H": "screen-top", "M": "screen-middle", "L": "screen-bottom",
+	"f": "find-char", "t": "till-char", "F": "find-char-back", "T": "till-char-back",
+	";": "repeat-find", ",": "repeat-find-back",
+	"gg": "first-line", "G": "last-line",
+	"n": "next-match", "N": "prev-match",
+	"*": "search-word", "#": "search-word-back",
+}
+
+var operatorKeys = map[string]string{
+	"d": "delete", "c": "change", "y": "yank", ">": "indent", "<lt>": "dedent",
+}
+
+var objectKeys = map[string]string{
+	"iw": "inner-word", "aw": "a-word", "iW": "inner-bigword", "aW": "a-bigword",
+	"is": "inner-sentence", "as": "a-sentence", "ip": "inner-paragraph", "ap": "a-paragraph",
+	`i"`: "inner-double-quote", `a"`: "a-double-quote",
+	"i'": "inner-single-quote", "a'": "a-single-quote",
+	"i`": "inner-backquote", "a`": "a-backquote",
+	"i(": "inner-paren", "i)": "inner-paren", "ib": "inner-paren",
+	"a(": "a-paren", "a)": "a-paren", "ab": "a-paren",
+	"i[": "inner-bracket", "i]": "inner-bracket", "a[": "a-bracket", "a]": "a-bracket",
+	"i{": "inner-brace", "i}": "inner-brace", "iB": "inner-brace",
+	"a{": "a-brace", "a}": "a-brace", "aB": "a-brace",
+	"i<lt>": "inner-angle", "i>": "inner-angle", "a<lt>": "a-angle", "a>": "a-angle",
+	"it": "inner-tag", "at": "a-tag",
+}
+
+var keymapDefs = map[string]keymapDef{
+	"edit": {
+		defaults: merge(motionKeys, operatorKeys, map[string]string{
+			"i": "insert", "o": "open-below", "x": "delete-char",
+			"p": "put", "P": "put-before", "u": "undo", "<C-r>": "redo",
+			"/": "search", "?": "search-back", ":": "command",
+			"v": "visual", "V": "visual-line", "<C-v>": "visual-block",
+			"<C-s>": "save", "<C-q>": "quit",
+		}),
+		valid: func(a string) bool {
+			_, mo := motions[a]
+			_, op := operators[a]
+			_, cmd := commands[a]
+			return mo || op || cmd
+		},
+	},
+	"visual": {
+		defaults: merge(motionKeys, operatorKeys, map[string]string{
+			"x": "delete", "o": "swap-anchor",
+			"v": "visual", "V": "visual-line", "<C-v>": "visual-block",
+		}),
+		valid: func(a string) bool {
+			_, mo := motions[a]
+			_, op := operators[a]
+			_, cmd := visualCommands[a]
+			return mo || op || cmd
+		},
+	},
+	// text objects, which are looked up before the edit keymap while an
+	// operator is pending and before the visual keymap.
+	"object": {
+		defaults: objectKeys,
+		valid: func(a string) bool {
+			_, ok := objects[a]
+			return ok
+		},
+	},
+	"emacs": {
+		defaults: map[string]string{
+			"<C-f>": "forward-char", "<Right>": "forward-char",
+			"<C-b>": "backward-char", "<Left>": "backward-char",
+			"<C-n>": "next-line", "<Down>": "next-line",
+			"<C-p>": "previous-line", "<Up>": "previous-line",
+			"<C-a>": "line-start", "<Home>": "line-start",
+			"<C-e>": "line-end", "<End>": "line-end",
+			"<M-f>": "forward-word", "<M-b>": "backward-word",
+			"<CR>": "newline", "<Tab>": "tab",
+			"<C-d>": "delete-char", "<Del>": "delete-char", "<BS>": "delete-backward-char",
+			"<C-k>": "kill-line", "<C-y>": "yank", "<C-_>": "undo", "<C-x>u": "undo",
+			"<C-s>": "isearch", "<C-r>": "isearch-backward", "<M-x>": "command",
+			"<C-x><C-s>": "save", "<C-x><C-c>": "quit",
+		},
+		valid: func(a string) bool {
+			_, ok := emacsCommands[a]
+			return ok
+		},
+	},
+	"insert": {
+		defaults: map[string]string{
+			"<CR>": "newline", "<BS>": "backspace", "<Tab>": "tab",
+			"<Up>": "up", "<Down>": "down", "<Left>": "left", "<Right>": "right",
+			"<C-s>": "save", "<C-q>": "quit",
+		},
+		valid: func(a string) bool {
+			_, ok := insertCommands[a]
+			return ok
+		},
+	},
+}
+
+func merge(maps ...map[string]string) map[string]string {
+	m := map[string]string{}
+	for _, mm := range maps {
+		for k, v := range mm {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// keymap returns the session's keymap for the named mode. Keymaps start out
+// with the default bindings, changed by the "keys.mode" sections of Config.
+func (s *Session) keymap(mode string) *Keymap {
+	if s.keymaps != nil {
+		return s.keymaps[mode]
+	}
+
+	s.keymaps = map[string]*Keymap{}
+	var modes []string
+	for name, def := range keymapDefs {
+		k := &Keymap{}
+		for seq, action := range def.defaults {
+			keys, err := parseKeys(seq)
+			if err != nil {
+				panic(err)
+			}
+			k.Map(keys, action)
+		}
+		s.keymaps[name] = k
+		modes = append(modes, name)
+	}
+	sort.Strings(modes)
+	for _, name := range modes {
+		sec := s.Config["keys."+name]
+		var seqs []string
+		for seq := range sec {
+			seqs = append(seqs, seq)
+		}
+		sort.Strings(seqs)
+		for _, seq := range seqs {
+			if err := s.mapKeys(name, seq, sec[seq]); err != nil {
+				s.Error("config: keys.%v: %v", name, err)
+			}
+		}
+	}
+	return s.keymaps[mode]
+}
+
+// mapKeys binds the key sequence seq to action in the keymap of mode. An
+// empty action removes the binding.
+func (s *Session) mapKeys(mode, seq, action string) error {
+	keys, err := parseKeys(seq)
+	if err != nil {
+		return err
+	}
+	k := s.keymap(mode)
+	if action == "" {
+		if !k.Unmap(keys) {
+			return fmt.Errorf("no mapping for %v", seq)
+		}
+		return nil
+	}
+	if !keymapDefs[mode].valid(action) {
+		return fmt.Errorf("no %v mode action %q", mode, action)
+	}
+	k.Map(keys, action)
+	return nil
+}
+
+// mapCommand returns the implementation of a :map command for mode. With no
+// argument it lists the mode's bindings and with just a key sequence it shows
+// that sequence's binding.
+func mapCommand(mode string) exCommand {
+	return func(s *Session, arg string, bang bool) error {
+		fields := strings.Fields(arg)
+		switch len(fields) {
+		case 0:
+			var lines []string
+			for _, b := range s.keymap(mode).Bindings() {
+				lines = append(lines, fmt.Sprintf("%-10v %v", b[0], b[1]))
+			}
+			s.mode = &ModeList{name: "MAP", lines: lines}
+			return nil
+		case 1:
+			keys, err := parseKeys(fields[0])
+			if err != nil {
+				return err
+			}
+			if action, _ := s.keymap(mode).Lookup(keys); action != "" {
+				s.Info("%v %v", fields[0], action)
+				return nil
+			}
+			return fmt.Errorf("no mapping for %v", fields[0])
+		case 2:
+			return s.mapKeys(mode, fields[0], fields[1])
+		}
+		return fmt.Errorf("usage: map keys action")
+	}
+}
+
+// unmapCommand returns the implementation of an :unmap command for mode.
+func unmapCommand(mode string) exCommand {
+	return func(s *Session, arg string, bang bool) error {
+		if arg == "" || strings.ContainsAny(arg, " \t") {
+			return fmt.Errorf("usage: unmap keys")
+		}
+		return s.mapKeys(mode, arg, "")
+	}
+}
@@ -0,0 +1,179 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Level is the severity of a message.
+type Level int
+
+const (
+	Info Level = iota
+	Warn
+	Error
+)
+
+var levelNames = []string{"info", "warn", "error"}
+
+func (l Level) String() string { return levelNames[l] }
+
+// Message is a message shown to the user.
+type Message struct {
+	Level Level
+	Text  string
+	Time  time.Time
+}
+
+// msgTimeout is how long a message is shown on the status line.
+const msgTimeout = 5 * time.Second
+
+// maxMessages is the number of messages kept for :messages.
+const maxMessages = 200
+
+// Info shows an informational message on the status line.
+func (s *Session) Info(format string, args ...interface{}) { s.message(Info, format, args...) }
+
+// Warn shows a warning on the status line.
+func (s *Session) Warn(format string, args ...interface{}) { s.message(Warn, format, args...) }
+
+// Error shows an error on the status line. It is used for errors the session
+// recovers from.
+func (s *Session) Error(format string, args ...interface{}) { s.message(Error, format, args...) }
+
+func (s *Session) message(lvl Level, format string, args ...interface{}) {
+	m := Message{Level: lvl, Text: fmt.Sprintf(format, args...), Time: time.Now()}
+	s.msgs = append(s.msgs, m)
+	if len(s.msgs) > maxMessages {
+		s.msgs = s.msgs[len(s.msgs)-maxMessages:]
+	}
+	s.msg = &m
+	s.msgExpire = m.Time.Add(msgTimeout)
+	if s.msgTimer == nil {
+		s.msgTimer = time.AfterFunc(msgTimeout, termbox.Interrupt)
+	} else {
+		s.msgTimer.Reset(msgTimeout)
+	}
+	if s.Log != nil {
+		s.Log.Printf("%v: %v", lvl, m.Text)
+	}
+}
+
+// Msg returns the text of the message shown on the status line, or "" if
+// there is none.
+func (s *Session) Msg() string {
+	if s.msg == nil {
+		return ""
+	}
+	return s.msg.Text
+}
+
+// expireMsg removes the message from the status line once its timeout has
+// passed.
+func (s *Session) expireMsg() {
+	if s.msg != nil && !time.Now().Before(s.msgExpire) {
+		s.msg = nil
+	}
+}
+
+// msgAttr returns the attributes a message of the given level is drawn
+// with.
+func (s *Session) msgAttr(lvl Level) (fg, bg termbox.Attribute) {
+	fg, bg = s.attr("status")
+	class := map[Level]string{Warn: "warning", Error: "error"}[lvl]
+	if mfg, mbg := s.attr(class); class != "" {
+		if mfg != 0 {
+			fg = mfg
+		}
+		if mbg != 0 {
+			bg = mbg
+		}
+	}
+	return fg, bg
+}
+
+func cmdMessages(s *Session, arg string, bang bool) error {
+	s.mode = &ModeMessages{}
+	return nil
+}
+
+// ModeMessages shows the message history until a key is pressed.
+type ModeMessages struct{}
+
+func (m *ModeMessages) Name() string { return "MESSAGES" }
+
+func (m *ModeMessages) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	return s.baseMode(), nil
+}
+
+func (m *ModeMessages) draw(s *Session) {
+	termbox.Clear(0, 0)
+	msgs := s.msgs
+	if len(msgs) > s.H {
+		msgs = msgs[len(msgs)-s.H:]
+	}
+	for y, msg := range msgs {
+		fg, _ := s.msgAttr(msg.Level)
+		if msg.Level == Info {
+			fg = 0
+		}
+		line := fmt.Sprintf("%v %-5v %v", msg.Time.Format("15:04:05"), msg.Level, msg.Text)
+		x := 0
+		for _, ch := range line {
+			termbox.SetCell(x, y, ch, fg, 0)
+			x++
+		}
+	}
+	drawMore(s, "press any key to continue")
+}
+
+// drawMore fills the status line with prompt for modes that take over the
+// screen.
+func drawMore(s *Session, prompt string) {
+	fg, bg := s.attr("status")
+	for x := 0; x < s.W; x++ {
+		termbox.SetCell(x, s.H, ' ', fg, bg)
+	}
+	for x, ch := range []rune(prompt) {
+		termbox.SetCell(x, s.H, ch, fg, bg)
+	}
+	termbox.HideCursor()
+}
+
+// ModeList shows lines of text a screenful at a time. Each key press shows
+// the next screenful, and the base mode is restored after the last.
+type ModeList struct {
+	name  string
+	lines []string
+	top   int // index of the first line shown
+}
+
+func (m *ModeList) Name() string { return m.name }
+
+func (m *ModeList) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	if ev.Key == termbox.KeyEsc || m.top+s.H >= len(m.lines) {
+		return s.baseMode(), nil
+	}
+	m.top += s.H
+	return m, nil
+}
+
+func (m *ModeList) draw(s *Session) {
+	termbox.Clear(0, 0)
+	lines := m.lines[m.top:]
+	if len(lines) > s.H {
+		lines = lines[:s.H]
+	}
+	for y, line := range lines {
+		for x, ch := range []rune(line) {
+			termbox.SetCell(x, y, ch, 0, 0)
+		}
+	}
+	if m.top+s.H < len(m.lines) {
+		drawMore(s, "-- more --")
+	} else {
+		drawMore(s, "press any key to continue")
+	}
+}
@@ -1,63 +1,139 @@
 package session
 
 import (
-	"io/ioutil"
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
 
 	termbox "github.com/nsf/termbox-go"
 	"github.com/rwcarlsen/editor/util"
-	"github.com/rwcarlsen/editor/view"
 )
 
 type ModeInsert struct {
 	s *Session
+	// count is the number of times the text typed in this mode is inserted
+	// in total. The text is repeated when leaving the mode.
+	count int
+	start int // offset at which the typed text begins
+	// done, if not nil, is called with the typed text when leaving the mode.
+	done func(s *Session, typed []byte)
+	// pending holds the keys typed so far of a mapped key sequence. They
+	// are inserted if the sequence turns out not to be mapped.
+	pending []termbox.Event
 }
 
-func (m *ModeInsert) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
-	m.s = s
-	if ev.Ch != 0 {
-		s.Insert(ev.Ch)
-		return m, nil
-	}
+// insertCommand is an insert mode action. It returns the mode to switch to,
+// or nil to stay in insert mode.
+type insertCommand func(m *ModeInsert, s *Session) (Mode, error)
 
-	switch ev.Key {
-	case termbox.KeyEnter:
+var insertCommands = map[string]insertCommand{
+	"newline": func(m *ModeInsert, s *Session) (Mode, error) {
 		space := BuildSmartIndent(s, s.CursorL)
 		s.Insert('\n')
 		s.Insert(space...)
-	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		return nil, nil
+	},
+	"backspace": func(m *ModeInsert, s *Session) (Mode, error) {
 		s.Delete(-1)
-	case termbox.KeySpace:
-		s.Insert(' ')
-	case termbox.KeyTab:
+		return nil, nil
+	},
+	"tab": func(m *ModeInsert, s *Session) (Mode, error) {
 		if s.ExpandTabs {
 			s.Insert([]rune(strings.Repeat(" ", s.Tabwidth))...)
 		} else {
 			s.Insert('\t')
 		}
-	case termbox.KeyArrowUp:
+		return nil, nil
+	},
+	"up": func(m *ModeInsert, s *Session) (Mode, error) {
 		s.SetCursor(s.CursorL-1, -1)
-	case termbox.KeyArrowDown:
+		return nil, nil
+	},
+	"down": func(m *ModeInsert, s *Session) (Mode, error) {
 		s.SetCursor(s.CursorL+1, -1)
-	case termbox.KeyArrowLeft:
+		return nil, nil
+	},
+	"left": func(m *ModeInsert, s *Session) (Mode, error) {
 		s.SetCursor(-1, s.CursorC-1)
-	case termbox.KeyArrowRight:
+		return nil, nil
+	},
+	"right": func(m *ModeInsert, s *Session) (Mode, error) {
 		s.SetCursor(-1, s.CursorC+1)
-	case termbox.KeyCtrlS:
-		err := ioutil.WriteFile(s.File, s.Buf.Bytes(), 0666)
-		if err != nil {
-			return m, err
-		}
-	case termbox.KeyEsc:
-		s.SetCursor(-1, s.CursorC-1)
-		return &ModeEdit{}, nil
-	case termbox.KeyCtrlQ:
-		return m, ErrQuit
+		return nil, nil
+	},
+	"save": func(m *ModeInsert, s *Session) (Mode, error) {
+		s.ctrlS()
+		return nil, nil
+	},
+	"quit":   func(m *ModeInsert, s *Session) (Mode, error) { return nil, s.ctrlQ() },
+	"escape": func(m *ModeInsert, s *Session) (Mode, error) { return m.escape(s), nil },
+}
+
+func (m *ModeInsert) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	m.s = s
+	if ev.Key == termbox.KeyEsc && ev.Ch == 0 {
+		m.flush(s)
+		return m.escape(s), nil
+	}
+
+	var keys []string
+	for _, p := range m.pending {
+		keys = append(keys, keyName(p))
+	}
+	keys = append(keys, keyName(ev))
+	action, prefix := s.keymap("insert").Lookup(keys)
+	if action != "" {
+		m.pending = nil
+		next, err := insertCommands[action](m, s)
+		return orMode(next, m), err
+	} else if prefix {
+		m.pending = append(m.pending, ev)
+		return m, nil
+	} else if len(m.pending) > 0 {
+		// the pending keys were not a mapped sequence after all; the last
+		// key may start a new one.
+		m.flush(s)
+		return m.HandleKey(s, ev)
+	}
+
+	if ev.Ch != 0 {
+		s.Insert(ev.Ch)
+	} else if ev.Key == termbox.KeySpace {
+		s.Insert(' ')
 	}
 	return m, nil
 }
 
+// flush inserts the pending keys as text.
+func (m *ModeInsert) flush(s *Session) {
+	for _, ev := range m.pending {
+		if ev.Ch != 0 {
+			s.Insert(ev.Ch)
+		} else if ev.Key == termbox.KeySpace {
+			s.Insert(' ')
+		}
+	}
+	m.pending = nil
+}
+
+// escape leaves insert mode, repeating the typed text if there was a count.
+func (m *ModeInsert) escape(s *Session) Mode {
+	var typed []byte
+	if end := s.Buf.Offset(s.CursorL, s.CursorC); end > m.start {
+		typed = s.Buf.Slice(m.start, end)
+	}
+	for i := 1; i < m.count && len(typed) > 0; i++ {
+		s.Insert([]rune(string(typed))...)
+	}
+	if m.done != nil {
+		m.done(s, typed)
+	}
+	s.EndGroup()
+	s.SetCursor(-1, s.CursorC-1)
+	return &ModeEdit{}
+}
+
 func BuildSmartIndent(s *Session, line int) (space []rune) {
 	if !s.SmartIndent {
 		return []rune{}
@@ -74,128 +150,398 @@ func BuildSmartIndent(s *Session, line int) (space []rune) {
 	return space
 }
 
+// ModeSearch reads a regexp and moves the cursor to the next match. The
+// search is previewed as the regexp is typed. The up and down arrow keys walk
+// through the search history.
 type ModeSearch struct {
-	s    *Session
-	view view.View
-	b    *util.Buffer
-	pos  int
+	p    *prompt
+	back bool // search backward
+	// again, if not 0, is a key that moves to the next match while the
+	// regexp is being typed, or recalls the last search if none was typed.
+	again termbox.Key
+	// done is called after a successful search and returns the mode to
+	// switch to. If done or its result is nil, the base mode is entered.
+	done func(s *Session) Mode
+	// cursor, scroll and search from before the search began
+	origL, origC, origY int
+	origSearch          *regexp.Regexp
+	origMatches         [][]int
+	origBack            bool
+	fromL, fromC        int  // where the preview searches from
+	wrapped             bool // true if the preview went around an end of the buffer
+	// nhist is the index in the search history of the shown entry, or its
+	// length if the text was typed. typed holds the typed text while a
+	// history entry is shown.
+	nhist int
+	typed string
 }
 
-func (m *ModeSearch) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
-	if m.s == nil {
-		m.s = s
-		m.b = util.NewBuffer([]byte{})
-		m.view = &view.Wrap{}
-		m.view.SetBuf(m.b)
-		m.view.SetSize(s.W-1, 1)
-		m.view.SetTabwidth(1)
+func (m *ModeSearch) init(s *Session) {
+	if m.p != nil {
+		return
 	}
+	prefix := '/'
+	if m.back {
+		prefix = '?'
+	}
+	m.p = newPrompt(s, prefix)
+	m.origL, m.origC, m.origY = s.CursorL, s.CursorC, s.Ypivot
+	m.origSearch, m.origMatches, m.origBack = s.Search, s.Matches, s.searchBack
+	m.fromL, m.fromC = s.CursorL, s.CursorC
+	m.nhist = len(s.searchHist)
+}
 
-	var err error
-	if ev.Ch != 0 {
-		m.b.Insert(m.pos, ev.Ch)
-		m.pos++
+func (m *ModeSearch) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	m.init(s)
+	if m.p.handleKey(ev) {
+		m.preview(s)
+		return m, nil
+	} else if m.again != 0 && ev.Key == m.again {
+		if m.p.text() == "" && len(s.searchHist) > 0 {
+			m.p.setText(s.searchHist[len(s.searchHist)-1])
+		} else {
+			m.fromL, m.fromC = s.CursorL, s.CursorC
+		}
+		m.preview(s)
+		return m, nil
 	}
+
 	switch ev.Key {
 	case termbox.KeyEnter:
-		s.Search, err = regexp.Compile(string(m.b.Bytes()))
-		if err != nil {
-			msg := err.Error()
-			for i, ch := range msg {
-				termbox.SetCell(i, s.H, ch, 0, 0)
-			}
-			return &ModeEdit{}, nil
-		}
-		s.UpdSearch()
-		s.NextMatch()
-		return &ModeEdit{}, nil
-	case termbox.KeySpace:
-		m.b.Insert(m.pos, ' ')
-		m.pos++
-	case termbox.KeyBackspace, termbox.KeyBackspace2:
-		m.b.Delete(m.pos, -1)
-		m.pos--
-	case termbox.KeyEsc:
-		return &ModeEdit{}, nil
-	}
-
-	surf := m.view.Render()
-	termbox.SetCell(0, s.H, '/', 0, 0)
-	view.Draw(surf, 1, s.H)
+		if m.p.text() == "" {
+			return s.baseMode(), nil
+		}
+		if err := m.preview(s); err != nil {
+			m.restore(s)
+			s.Error("%v", err)
+			return s.baseMode(), nil
+		}
+		s.addSearchHist(m.p.text())
+		if len(s.Matches) == 0 {
+			s.Error("pattern not found: %v", m.p.text())
+		} else if m.wrapped {
+			s.warnWrap(m.back)
+		}
+		if m.done != nil {
+			return orMode(m.done(s), s.baseMode()), nil
+		}
+		return s.baseMode(), nil
+	case termbox.KeyEsc, termbox.KeyCtrlG:
+		m.restore(s)
+		return s.baseMode(), nil
+	case termbox.KeyArrowUp:
+		m.history(s, -1)
+	case termbox.KeyArrowDown:
+		m.history(s, 1)
+	}
 	return m, nil
 }
 
+// history replaces the prompt text with the search history entry dir
+// entries after the one shown.
+func (m *ModeSearch) history(s *Session, dir int) {
+	n := m.nhist + dir
+	if n < 0 || n > len(s.searchHist) {
+		return
+	}
+	if m.nhist == len(s.searchHist) {
+		m.typed = m.p.text()
+	}
+	m.nhist = n
+	if n == len(s.searchHist) {
+		m.p.setText(m.typed)
+	} else {
+		m.p.setText(s.searchHist[n])
+	}
+	m.preview(s)
+}
+
+// preview searches for the text typed so far and moves the cursor to the
+// first match after where it was when the search began. If the text is not a
+// valid regexp, the previous matches are kept. Nothing is reported, since the
+// text is not complete yet.
+func (m *ModeSearch) preview(s *Session) error {
+	if m.p.text() == "" {
+		m.restore(s)
+		return nil
+	}
+	re, err := regexp.Compile(m.p.text())
+	if err != nil {
+		return err
+	}
+	s.Search, s.searchBack = re, m.back
+	s.nohl = false
+	s.UpdSearch()
+	s.CursorL, s.CursorC, s.Ypivot = m.origL, m.origC, m.origY
+	var match int
+	match, m.wrapped = s.findMatch(s.Buf.Offset(m.fromL, m.fromC), m.back)
+	s.SetCursor(s.Buf.Pos(match))
+	return nil
+}
+
+// restore puts back the cursor, scroll and search from before the search
+// began.
+func (m *ModeSearch) restore(s *Session) {
+	s.CursorL, s.CursorC, s.Ypivot = m.origL, m.origC, m.origY
+	s.Search, s.Matches, s.searchBack = m.origSearch, m.origMatches, m.origBack
+}
+
+func (m *ModeSearch) draw(s *Session) {
+	m.init(s)
+	m.p.draw(s)
+	if m.p.text() == "" || s.Search == m.origSearch {
+		return
+	}
+
+	// show which match the cursor is on and how many there are
+	cursor := s.Buf.Offset(s.CursorL, s.CursorC)
+	n := 0
+	for i, match := range s.Matches {
+		if match[0] == cursor {
+			n = i + 1
+			break
+		}
+	}
+	count := fmt.Sprintf("%d/%d", n, len(s.Matches))
+	for i, ch := range count {
+		termbox.SetCell(s.W-len(count)+i, s.H, ch, 0, 0)
+	}
+}
+
+// command is an edit mode command other than a motion or operator. n is the
+// count typed before it, or 0 if there was none. It returns the mode to switch
+// to, or nil to stay in edit mode.
+type command func(s *Session, n int) (Mode, error)
+
+var commands = map[string]command{
+	"insert": func(s *Session, n int) (Mode, error) {
+		s.StartGroup()
+		return &ModeInsert{count: n, start: s.Buf.Offset(s.CursorL, s.CursorC)}, nil
+	},
+	"open-below": func(s *Session, n int) (Mode, error) {
+		s.StartGroup()
+		l := s.Buf.Line(s.CursorL)
+		s.SetCursor(-1, len(l)-1)
+		start := s.Buf.Offset(s.CursorL, s.CursorC)
+		space := BuildSmartIndent(s, s.CursorL)
+		s.Insert('\n')
+		s.Insert(space...)
+		return &ModeInsert{count: n, start: start}, nil
+	},
+	"delete-char": func(s *Session, n int) (Mode, error) {
+		start := s.Buf.Offset(s.CursorL, s.CursorC)
+		end := start
+		for i := 0; i < util.Max(n, 1); i++ {
+			r, size := s.Buf.RuneAt(end)
+			if size == 0 || r == '\n' {
+				break
+			}
+			end += size
+		}
+		s.Yank(s.Buf.Slice(start, end), false)
+		s.Replace(start, end, nil)
+		return nil, nil
+	},
+	"put": func(s *Session, n int) (Mode, error) {
+		s.Put(false, n)
+		return nil, nil
+	},
+	"put-before": func(s *Session, n int) (Mode, error) {
+		s.Put(true, n)
+		return nil, nil
+	},
+	"undo": func(s *Session, n int) (Mode, error) {
+		for i := 0; i < util.Max(n, 1); i++ {
+			if !s.Undo() {
+				break
+			}
+		}
+		return nil, nil
+	},
+	"redo": func(s *Session, n int) (Mode, error) {
+		for i := 0; i < util.Max(n, 1); i++ {
+			if !s.Redo() {
+				break
+			}
+		}
+		return nil, nil
+	},
+	"save": func(s *Session, n int) (Mode, error) {
+		s.ctrlS()
+		return nil, nil
+	},
+	"quit":         func(s *Session, n int) (Mode, error) { return nil, s.ctrlQ() },
+	"search":       func(s *Session, n int) (Mode, error) { return &ModeSearch{}, nil },
+	"search-back":  func(s *Session, n int) (Mode, error) { return &ModeSearch{back: true}, nil },
+	"command":      func(s *Session, n int) (Mode, error) { return &ModeCommand{}, nil },
+	"visual":       func(s *Session, n int) (Mode, error) { return NewModeVisual(s, VisualChar), nil },
+	"visual-line":  func(s *Session, n int) (Mode, error) { return NewModeVisual(s, VisualLine), nil },
+	"visual-block": func(s *Session, n int) (Mode, error) { return NewModeVisual(s, VisualBlock), nil },
+}
+
+// maxCount is the largest count accepted before a command. Larger counts are
+// clamped to it.
+const maxCount = 1 << 20
+
+// ModeEdit parses key sequences of the form
+//
+//	["register][count][operator][count]motion or ["register][count]command
+//
+// Operators (d, c, y, >, <) wait for a motion and act on the text it moves
+// over; a doubled operator (e.g. dd) acts on count lines starting with the
+// current one. Counts repeat the motion or command. Which keys stand for
+// which motions, operators and commands is set by the "edit" keymap.
 type ModeEdit struct {
 	s       *Session
-	prevkey rune
+	keys    []string // pending keys of a multi-key motion or command
+	op      string   // pending operator
+	count   int      // count being typed, or 0 if none
+	opcount int      // count typed before the pending operator, or 0 if none
+	reg     rune     // register selected with ", or 0 if none
+	// withChar is set while a motion such as f waits for its character.
+	withChar func(s *Session, ch rune) motion
 }
 
 func (m *ModeEdit) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
 	m.s = s
+	defer s.SelectRegister(0)
+	if ev.Key == termbox.KeyEsc && ev.Ch == 0 {
+		m.reset()
+		return m, nil
+	} else if m.withChar != nil {
+		if ch := typedChar(ev); ch != 0 {
+			return m.motion(s, m.withChar(s, ch)), nil
+		}
+		m.reset()
+		return m, nil
+	}
 
-	switch m.prevkey {
-	case 'g':
-		switch ev.Ch {
-		case 'g':
-			if m.prevkey == 'g' {
-				m.prevkey = 0
-				s.SetCursor(0, 0)
-			}
-		default:
-			m.prevkey = 0
-		}
-	case 0:
-		switch ev.Ch {
-		case 'i':
-			return &ModeInsert{}, nil
-		case 'j':
-			s.SetCursor(s.CursorL+1, -1)
-		case 'k':
-			s.SetCursor(s.CursorL-1, -1)
-		case 'l':
-			s.SetCursor(-1, s.CursorC+1)
-		case 'h':
-			s.SetCursor(-1, s.CursorC-1)
-		case 'o':
-			l := s.Buf.Line(s.CursorL)
-			s.SetCursor(-1, len(l)-1)
-			space := BuildSmartIndent(s, s.CursorL)
-			s.Insert('\n')
-			s.Insert(space...)
-			return &ModeInsert{}, nil
-		case 'x':
-			s.Delete(1)
-			s.SetCursor(-1, s.CursorC+1)
-		case 'g':
-			m.prevkey = 'g'
-		case 'G':
-			s.SetCursor(s.Buf.Nlines()-1, 0)
-		case '/':
-			termbox.SetCell(0, s.H, '/', 0, 0)
-			return &ModeSearch{}, nil
-		case 'n':
-			s.NextMatch()
+	ch := ev.Ch
+	if len(m.keys) == 1 && m.keys[0] == "\"" {
+		m.keys = nil
+		if !ValidRegister(ch) {
+			m.reset()
+			return m, nil
 		}
+		m.reg = ch
+		return m, nil
+	} else if len(m.keys) == 0 && ch == '"' && m.op == "" {
+		m.keys = []string{"\""}
+		return m, nil
+	} else if len(m.keys) == 0 && ch >= '0' && ch <= '9' && (ch != '0' || m.count > 0) {
+		m.count = util.Min(m.count*10+int(ch-'0'), maxCount)
+		return m, nil
 	}
 
-	switch ev.Key {
-	case termbox.KeyArrowUp:
-		s.SetCursor(s.CursorL-1, -1)
-	case termbox.KeyArrowDown, termbox.KeyEnter:
-		s.SetCursor(s.CursorL+1, -1)
-	case termbox.KeyArrowLeft, termbox.KeyBackspace, termbox.KeyBackspace2:
-		s.SetCursor(-1, s.CursorC-1)
-	case termbox.KeyArrowRight, termbox.KeySpace:
-		s.SetCursor(-1, s.CursorC+1)
-	case termbox.KeyCtrlS:
-		err := ioutil.WriteFile(s.File, s.Buf.Bytes(), 0666)
-		if err != nil {
-			return m, err
+	m.keys = append(m.keys, keyName(ev))
+	modes := []string{"edit"}
+	if m.op != "" {
+		modes = []string{"object", "edit"}
+	}
+	action, prefix := s.lookup(m.keys, modes...)
+	if action == "" {
+		if !prefix {
+			m.reset()
 		}
-	case termbox.KeyEsc:
-		m.prevkey = 0
-	case termbox.KeyCtrlQ:
-		return m, ErrQuit
+		return m, nil
 	}
+
+	op, n, reg := m.op, m.n(), m.reg
+	offset := s.Buf.Offset(s.CursorL, s.CursorC)
+	if op != "" && action == op {
+		m.reset()
+		s.SelectRegister(reg)
+		to := lineOffset(s, offset, util.Max(n, 1)-1)
+		start, end := s.span(offset, to, motion{linewise: true})
+		return orMode(operators[op](s, start, end, true), m), nil
+	} else if obj, ok := objects[action]; ok && op != "" {
+		m.reset()
+		start, end, ok := obj.fn(s.Buf, offset, obj.inner)
+		if !ok {
+			return m, nil
+		}
+		s.SelectRegister(reg)
+		return orMode(operators[op](s, start, end, obj.linewise), m), nil
+	} else if mo, ok := motions[action]; ok {
+		if mo.withChar != nil {
+			m.keys = nil
+			m.withChar = mo.withChar
+			return m, nil
+		} else if mo.resolve != nil {
+			mo = mo.resolve(s)
+		}
+		if r, _ := s.Buf.RuneAt(offset); op == "change" && !unicode.IsSpace(r) {
+			// cw changes to the end of the word like vi
+			if action == "word" {
+				mo = motions["word-end"]
+			} else if action == "bigword" {
+				mo = motions["bigword-end"]
+			}
+		}
+		return m.motion(s, mo), nil
+	} else if op != "" && (action == "search" || action == "search-back") {
+		m.reset()
+		return &ModeSearch{back: action == "search-back", done: func(s *Session) Mode {
+			to := s.Buf.Offset(s.CursorL, s.CursorC)
+			start, end := s.span(offset, to, motion{})
+			s.SelectRegister(reg)
+			return operators[op](s, start, end, false)
+		}}, nil
+	} else if _, ok := operators[action]; ok && op == "" {
+		m.keys = nil
+		m.op = action
+		m.opcount, m.count = m.count, 0
+		return m, nil
+	} else if cmd, ok := commands[action]; ok && op == "" {
+		m.reset()
+		s.SelectRegister(reg)
+		next, err := cmd(s, n)
+		return orMode(next, m), err
+	}
+	m.reset()
 	return m, nil
 }
+
+// motion makes the motion mo, applying the pending operator, if any, to the
+// text it moves over.
+func (m *ModeEdit) motion(s *Session, mo motion) Mode {
+	op, n, reg := m.op, m.n(), m.reg
+	m.reset()
+	offset := s.Buf.Offset(s.CursorL, s.CursorC)
+	to := mo.fn(s, offset, n)
+	if op == "" {
+		s.SetCursor(s.Buf.Pos(to))
+		return m
+	}
+	start, end := s.span(offset, to, mo)
+	s.SelectRegister(reg)
+	return orMode(operators[op](s, start, end, mo.linewise), m)
+}
+
+func (m *ModeEdit) reset() {
+	m.keys = nil
+	m.withChar = nil
+	m.op = ""
+	m.count = 0
+	m.opcount = 0
+	m.reg = 0
+}
+
+// n returns the total count for the pending command, or 0 if no count was
+// typed.
+func (m *ModeEdit) n() int {
+	if m.opcount == 0 {
+		return m.count
+	} else if m.count == 0 {
+		return m.opcount
+	}
+	return util.Min(m.opcount*m.count, maxCount)
+}
+
+// orMode returns next if it is non-nil and cur otherwise.
+func orMode(next, cur Mode) Mode {
+	if next != nil {
+		return next
+	}
+	return cur
+}
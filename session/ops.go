@@ -0,0 +1,369 @@
+package session
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rwcarlsen/editor/util"
+	"github.com/rwcarlsen/editor/view"
+)
+
+// motion moves the cursor from a byte offset to a new one. Operators act on
+// the text between the two offsets.
+type motion struct {
+	// fn returns the destination of the motion. n is the count typed before
+	// it, or 0 if there was none.
+	fn func(s *Session, offset, n int) int
+	// linewise motions make operators act on every line they touch.
+	linewise bool
+	// inclusive motions make operators act on the character at the
+	// destination as well.
+	inclusive bool
+	// withChar is set for motions that wait for a character to be typed,
+	// such as f. It returns the motion to make for the character.
+	withChar func(s *Session, ch rune) motion
+	// resolve is set for motions that depend on an earlier one, such as ;.
+	// It returns the motion to make.
+	resolve func(s *Session) motion
+}
+
+// repeat returns a motion function that applies f n times, or once if n is 0.
+func repeat(f func(s *Session, offset int) int) func(s *Session, offset, n int) int {
+	return func(s *Session, offset, n int) int {
+		for i := 0; i < util.Max(n, 1); i++ {
+			next := f(s, offset)
+			if next == offset {
+				break
+			}
+			offset = next
+		}
+		return offset
+	}
+}
+
+// gotoLine returns a motion function moving to line n (1-based), or to line
+// def if n is 0.
+func gotoLine(def func(s *Session) int) func(s *Session, offset, n int) int {
+	return func(s *Session, offset, n int) int {
+		line := n - 1
+		if n == 0 {
+			line = def(s)
+		}
+		line = util.Max(util.Min(line, s.Buf.Nlines()-1), 0)
+		return s.Buf.Offset(line, 0)
+	}
+}
+
+// motions are keyed by the names keymaps bind them to.
+var motions = map[string]motion{
+	"left": {fn: repeat(func(s *Session, offset int) int {
+		if r, size := s.Buf.RuneBefore(offset); size > 0 && r != '\n' {
+			return offset - size
+		}
+		return offset
+	})},
+	"right": {fn: repeat(func(s *Session, offset int) int {
+		if r, size := s.Buf.RuneAt(offset); size > 0 && r != '\n' {
+			return offset + size
+		}
+		return offset
+	})},
+	"down": {fn: func(s *Session, offset, n int) int {
+		return lineOffset(s, offset, util.Max(n, 1))
+	}, linewise: true},
+	"up": {fn: func(s *Session, offset, n int) int {
+		return lineOffset(s, offset, -util.Max(n, 1))
+	}, linewise: true},
+	"word":           {fn: repeat(func(s *Session, offset int) int { return util.NextWord(s.Buf, offset) })},
+	"word-back":      {fn: repeat(func(s *Session, offset int) int { return util.PrevWord(s.Buf, offset) })},
+	"word-end":       {fn: repeat(func(s *Session, offset int) int { return util.WordEnd(s.Buf, offset) }), inclusive: true},
+	"bigword":        {fn: repeat(func(s *Session, offset int) int { return util.NextBigWord(s.Buf, offset) })},
+	"bigword-back":   {fn: repeat(func(s *Session, offset int) int { return util.PrevBigWord(s.Buf, offset) })},
+	"bigword-end":    {fn: repeat(func(s *Session, offset int) int { return util.BigWordEnd(s.Buf, offset) }), inclusive: true},
+	"paragraph":      {fn: repeat(func(s *Session, offset int) int { return util.NextParagraph(s.Buf, offset) })},
+	"paragraph-back": {fn: repeat(func(s *Session, offset int) int { return util.PrevParagraph(s.Buf, offset) })},
+	"match-bracket": {fn: func(s *Session, offset, n int) int {
+		offset, _ = util.MatchBracket(s.Buf, offset)
+		return offset
+	}, inclusive: true},
+	"line-start":      {fn: func(s *Session, offset, n int) int { return util.LineStart(s.Buf, offset) }},
+	"first-non-blank": {fn: func(s *Session, offset, n int) int { return util.FirstNonBlank(s.Buf, offset) }},
+	"line-end": {fn: func(s *Session, offset, n int) int {
+		if n > 1 {
+			offset = lineOffset(s, offset, n-1)
+		}
+		return util.LineEnd(s.Buf, offset)
+	}, inclusive: true},
+	"first-line":       {fn: gotoLine(func(s *Session) int { return 0 }), linewise: true},
+	"last-line":        {fn: gotoLine(func(s *Session) int { return s.Buf.Nlines() - 1 }), linewise: true},
+	"next-match":       {fn: repeat(func(s *Session, offset int) int { return s.nextMatch(offset, s.searchBack) })},
+	"prev-match":       {fn: repeat(func(s *Session, offset int) int { return s.nextMatch(offset, !s.searchBack) })},
+	"search-word":      {fn: searchWord(false)},
+	"search-word-back": {fn: searchWord(true)},
+	"screen-top": {fn: screenLine(func(first, last, n int) int {
+		return first + util.Max(n, 1) - 1
+	}), linewise: true},
+	"screen-middle": {fn: screenLine(func(first, last, n int) int {
+		return (first + last) / 2
+	}), linewise: true},
+	"screen-bottom": {fn: screenLine(func(first, last, n int) int {
+		return last - util.Max(n, 1) + 1
+	}), linewise: true},
+	"find-char":        {withChar: findChar(false, false)},
+	"till-char":        {withChar: findChar(false, true)},
+	"find-char-back":   {withChar: findChar(true, false)},
+	"till-char-back":   {withChar: findChar(true, true)},
+	"repeat-find":      {resolve: func(s *Session) motion { return s.lastFind.motion(false, true) }},
+	"repeat-find-back": {resolve: func(s *Session) motion { return s.lastFind.motion(true, true) }},
+}
+
+// screenLine returns a motion function moving to the first non-blank
+// character of a line on the screen. pick chooses it from the first and last
+// lines whose start is shown.
+func screenLine(pick func(first, last, n int) int) func(s *Session, offset, n int) int {
+	return func(s *Session, offset, n int) int {
+		s.View.SetRef(s.CursorL, 0, 0, s.Ypivot)
+		surf := s.View.Render()
+		first, last := view.Lines(surf)
+		if first == -1 {
+			return offset
+		}
+		if first < last && !view.Contains(surf, first, 0) {
+			first++ // only the end of a wrapped line is shown
+		}
+		line := util.Max(util.Min(pick(first, last, n), last), first)
+		return util.FirstNonBlank(s.Buf, s.Buf.Offset(line, 0))
+	}
+}
+
+// charSearch is a search for a character on the cursor's line made by f, t,
+// F or T.
+type charSearch struct {
+	ch         rune
+	back, till bool
+}
+
+// findChar returns the withChar function of a character search motion.
+func findChar(back, till bool) func(s *Session, ch rune) motion {
+	return func(s *Session, ch rune) motion {
+		s.lastFind = charSearch{ch: ch, back: back, till: till}
+		return s.lastFind.motion(false, false)
+	}
+}
+
+// motion returns the motion making the search, in the opposite direction if
+// reverse is true. A repeated (by ; or ,) till search skips a match next to
+// the cursor, which it would not move from otherwise.
+func (c charSearch) motion(reverse, repeat bool) motion {
+	back := c.back != reverse
+	return motion{fn: func(s *Session, offset, n int) int {
+		pos := offset
+		if to, ok := util.FindChar(s.Buf, pos, c.ch, back, true); repeat && c.till && ok && to == pos {
+			pos, _ = util.FindChar(s.Buf, pos, c.ch, back, false)
+		}
+		for i := 1; i < n; i++ {
+			var ok bool
+			if pos, ok = util.FindChar(s.Buf, pos, c.ch, back, false); !ok {
+				return offset
+			}
+		}
+		to, ok := util.FindChar(s.Buf, pos, c.ch, back, c.till)
+		if !ok {
+			return offset
+		}
+		return to
+	}, inclusive: !back}
+}
+
+// searchWord returns a motion function that searches for the word under or
+// after the cursor, backward if back is true.
+func searchWord(back bool) func(s *Session, offset, n int) int {
+	return func(s *Session, offset, n int) int {
+		word, start := wordAt(s.Buf, offset)
+		if word == "" {
+			s.Error("no word under cursor")
+			return offset
+		}
+		pattern := regexp.QuoteMeta(word)
+		if r := []rune(word); isASCIIWord(r[0]) && isASCIIWord(r[len(r)-1]) {
+			pattern = `\b` + pattern + `\b`
+		}
+		s.Search = regexp.MustCompile(pattern)
+		s.searchBack = back
+		s.addSearchHist(pattern)
+		s.UpdSearch()
+		return repeat(func(s *Session, offset int) int { return s.nextMatch(offset, back) })(s, start, n)
+	}
+}
+
+func isWordRune(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func isASCIIWord(r rune) bool { return r < utf8.RuneSelf && isWordRune(r) }
+
+// wordAt returns the word containing offset, or the first one after it on the
+// same line, and the offset it starts at.
+func wordAt(b *util.Buffer, offset int) (word string, start int) {
+	l, c := b.Pos(offset)
+	line := b.Line(l)
+	for c < len(line) && !isWordRune(line[c]) {
+		c++
+	}
+	if c == len(line) {
+		return "", offset
+	}
+	first, last := c, c
+	for first > 0 && isWordRune(line[first-1]) {
+		first--
+	}
+	for last < len(line) && isWordRune(line[last]) {
+		last++
+	}
+	return string(line[first:last]), b.Offset(l, first)
+}
+
+// lineOffset returns the offset of the character in the same column as
+// offset n lines up or down from it.
+func lineOffset(s *Session, offset, n int) int {
+	line, char := s.Buf.Pos(offset)
+	line = util.Max(util.Min(line+n, s.Buf.Nlines()-1), 0)
+	char = util.Min(char, len(s.Buf.Line(line))-1)
+	return s.Buf.Offset(line, char)
+}
+
+// span returns the range an operator acts on when moving from offset
+// from to offset to with the given motion.
+func (s *Session) span(from, to int, mo motion) (start, end int) {
+	start, end = util.Min(from, to), util.Max(from, to)
+	if mo.linewise {
+		start = util.LineStart(s.Buf, start)
+		line, _ := s.Buf.Pos(end)
+		end = s.Buf.Offset(line+1, 0)
+	} else if r, size := s.Buf.RuneAt(end); mo.inclusive && r != '\n' {
+		end += size
+	} else if r, _ := s.Buf.RuneBefore(end); !mo.inclusive && r == '\n' && end > start {
+		// like vi, an exclusive motion ending at the start of a line does
+		// not include the preceding newline.
+		end--
+	}
+	return start, end
+}
+
+// object is a text object, such as a word or a quoted string, that
+// operators can act on and visual mode can select.
+type object struct {
+	fn       util.TextObject
+	inner    bool
+	linewise bool
+}
+
+// objects are keyed by the names keymaps bind them to.
+var objects = map[string]object{
+	"inner-word":         {fn: util.Word, inner: true},
+	"a-word":             {fn: util.Word},
+	"inner-bigword":      {fn: util.BigWord, inner: true},
+	"a-bigword":          {fn: util.BigWord},
+	"inner-sentence":     {fn: util.Sentence, inner: true},
+	"a-sentence":         {fn: util.Sentence},
+	"inner-paragraph":    {fn: util.Paragraph, inner: true, linewise: true},
+	"a-paragraph":        {fn: util.Paragraph, linewise: true},
+	"inner-double-quote": {fn: util.Quote('"'), inner: true},
+	"a-double-quote":     {fn: util.Quote('"')},
+	"inner-single-quote": {fn: util.Quote('\''), inner: true},
+	"a-single-quote":     {fn: util.Quote('\'')},
+	"inner-backquote":    {fn: util.Quote('`'), inner: true},
+	"a-backquote":        {fn: util.Quote('`')},
+	"inner-paren":        {fn: util.Bracket('(', ')'), inner: true},
+	"a-paren":            {fn: util.Bracket('(', ')')},
+	"inner-bracket":      {fn: util.Bracket('[', ']'), inner: true},
+	"a-bracket":          {fn: util.Bracket('[', ']')},
+	"inner-brace":        {fn: util.Bracket('{', '}'), inner: true},
+	"a-brace":            {fn: util.Bracket('{', '}')},
+	"inner-angle":        {fn: util.Bracket('<', '>'), inner: true},
+	"a-angle":            {fn: util.Bracket('<', '>')},
+	"inner-tag":          {fn: util.Tag, inner: true},
+	"a-tag":              {fn: util.Tag},
+}
+
+// operator acts on the byte range [start, end) of the buffer and returns the
+// mode to switch to, or nil to stay in the current mode.
+type operator func(s *Session, start, end int, linewise bool) Mode
+
+var operators = map[string]operator{
+	"delete": opDelete,
+	"change": opChange,
+	"yank":   opYank,
+	"indent": func(s *Session, start, end int, linewise bool) Mode {
+		return opIndent(s, start, end, 1)
+	},
+	"dedent": func(s *Session, start, end int, linewise bool) Mode {
+		return opIndent(s, start, end, -1)
+	},
+}
+
+func opDelete(s *Session, start, end int, linewise bool) Mode {
+	s.Yank(s.Buf.Slice(start, end), linewise)
+	s.Replace(start, end, nil)
+	if linewise {
+		s.SetCursor(s.Buf.Pos(util.FirstNonBlank(s.Buf, start)))
+	}
+	return nil
+}
+
+func opChange(s *Session, start, end int, linewise bool) Mode {
+	s.Yank(s.Buf.Slice(start, end), linewise)
+	if linewise {
+		start = util.FirstNonBlank(s.Buf, start)
+		if r, _ := s.Buf.RuneBefore(end); r == '\n' {
+			end--
+		}
+		end = util.Max(start, end)
+	}
+	s.StartGroup()
+	s.Replace(start, end, nil)
+	return &ModeInsert{start: start}
+}
+
+func opYank(s *Session, start, end int, linewise bool) Mode {
+	s.Yank(s.Buf.Slice(start, end), linewise)
+	s.SetCursor(s.Buf.Pos(start))
+	return nil
+}
+
+// opIndent adds (dir > 0) or removes (dir < 0) one level of indentation from
+// every line in the range.
+func opIndent(s *Session, start, end int, dir int) Mode {
+	indent := "\t"
+	if s.ExpandTabs {
+		indent = strings.Repeat(" ", s.Tabwidth)
+	}
+
+	first, _ := s.Buf.Pos(start)
+	last, _ := s.Buf.Pos(util.Max(end-1, start))
+	s.StartGroup()
+	defer s.EndGroup()
+	for l := first; l <= last && l < s.Buf.Nlines(); l++ {
+		offset := s.Buf.Offset(l, 0)
+		line := []byte(string(s.Buf.Line(l)))
+		if dir > 0 {
+			if len(bytes.TrimSpace(line)) > 0 {
+				s.Replace(offset, offset, []byte(indent))
+			}
+			continue
+		}
+
+		n := 0
+		if line[0] == '\t' {
+			n = 1
+		} else {
+			for n < len(line) && n < s.Tabwidth && line[n] == ' ' {
+				n++
+			}
+		}
+		s.Replace(offset, offset+n, nil)
+	}
+	s.SetCursor(s.Buf.Pos(util.FirstNonBlank(s.Buf, s.Buf.Offset(first, 0))))
+	return nil
+}
@@ -0,0 +1,351 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/editor/editorconfig"
+	"github.com/rwcarlsen/editor/theme"
+	"github.com/rwcarlsen/editor/view"
+)
+
+// option is a setting that can be changed with :set, in the config file and
+// with command line flags. Values are passed around in their string form.
+type option struct {
+	name, short string
+	boolean     bool
+	local       bool // set per file; see configure
+	get         func(s *Session) string
+	set         func(s *Session, val string) error
+}
+
+var options = []*option{
+	{
+		name: "tabwidth", short: "tw", local: true,
+		get: func(s *Session) string { return strconv.Itoa(s.Tabwidth) },
+		set: func(s *Session, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid tabwidth %q", val)
+			}
+			s.Tabwidth = n
+			s.View.SetTabwidth(n)
+			return nil
+		},
+	},
+	localOption(boolOption("expandtab", "et", func(s *Session) *bool { return &s.ExpandTabs })),
+	localOption(boolOption("smartindent", "si", func(s *Session) *bool { return &s.SmartIndent })),
+	boolOption("backup", "bk", func(s *Session) *bool { return &s.Backup }),
+	localOption(boolOption("trimspace", "", func(s *Session) *bool { return &s.TrimSpace })),
+	localOption(boolOption("finalnewline", "", func(s *Session) *bool { return &s.FinalNewline })),
+	{
+		name: "charset", local: true,
+		get: func(s *Session) string { return s.Charset },
+		set: func(s *Session, val string) error {
+			if !charsets[val] {
+				return fmt.Errorf("unknown charset %q", val)
+			}
+			s.Charset = val
+			return nil
+		},
+	},
+	{
+		name: "endofline", short: "eol", local: true,
+		get: func(s *Session) string { return s.EOL },
+		set: func(s *Session, val string) error {
+			if _, ok := eols[val]; !ok {
+				return fmt.Errorf("invalid endofline %q", val)
+			}
+			s.EOL = val
+			return nil
+		},
+	},
+	{
+		name: "number", short: "nu", boolean: true,
+		get: func(s *Session) string {
+			_, ok := s.View.(*view.LineNum)
+			return strconv.FormatBool(ok)
+		},
+		set: func(s *Session, val string) error {
+			on, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for number: %q", val)
+			}
+			ln, ok := s.View.(*view.LineNum)
+			if on == ok {
+				return nil
+			} else if on {
+				s.View = &view.LineNum{View: s.View}
+			} else {
+				s.View = ln.View
+			}
+			s.View.SetSize(s.W, s.H)
+			s.View.SetTabwidth(s.Tabwidth)
+			if s.Buf != nil {
+				s.View.SetBuf(s.Buf)
+			}
+			return nil
+		},
+	},
+	{
+		name: "keymap",
+		get: func(s *Session) string {
+			if s.Bindings == "" {
+				return "vi"
+			}
+			return s.Bindings
+		},
+		set: func(s *Session, val string) error {
+			if val != "vi" && val != "emacs" {
+				return fmt.Errorf("unknown keymap %q", val)
+			}
+			s.Bindings = val
+			if s.mode != nil {
+				s.mode = s.baseMode()
+			}
+			return nil
+		},
+	},
+	{
+		name: "theme",
+		get: func(s *Session) string {
+			if s.Theme == nil {
+				return theme.Default.Name
+			}
+			return s.Theme.Name
+		},
+		set: func(s *Session, val string) error {
+			t, err := theme.Load(val)
+			if err != nil {
+				return err
+			}
+			s.SetTheme(t)
+			return nil
+		},
+	},
+}
+
+// boolOption returns an option that sets the bool field returned by field.
+func boolOption(name, short string, field func(s *Session) *bool) *option {
+	return &option{
+		name: name, short: short, boolean: true,
+		get: func(s *Session) string { return strconv.FormatBool(*field(s)) },
+		set: func(s *Session, val string) error {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for %v: %q", name, val)
+			}
+			*field(s) = b
+			return nil
+		},
+	}
+}
+
+// localOption marks opt as set per file.
+func localOption(opt *option) *option {
+	opt.local = true
+	return opt
+}
+
+func findOption(name string) *option {
+	for _, opt := range options {
+		if name == opt.name || (name == opt.short && name != "") {
+			return opt
+		}
+	}
+	return nil
+}
+
+// IsOption returns true if name is the name of an option.
+func IsOption(name string) bool { return findOption(name) != nil }
+
+// SetOption sets the named option from the string form of its value.
+func (s *Session) SetOption(name, val string) error {
+	opt := findOption(name)
+	if opt == nil {
+		return fmt.Errorf("unknown option %q", name)
+	}
+	return opt.set(s, val)
+}
+
+// Option returns the string form of the named option's value.
+func (s *Session) Option(name string) (string, error) {
+	opt := findOption(name)
+	if opt == nil {
+		return "", fmt.Errorf("unknown option %q", name)
+	}
+	return opt.get(s), nil
+}
+
+// configure applies the option settings for the session's file. Global
+// options are set only the first time, from the top-level section of Config
+// and then Flags, so that later :set commands survive opening other files.
+// Per-file options are set every time: first to the values they had before
+// the first file was configured, then from the top-level section of Config,
+// the "filetype.ext" section for the file's extension, .editorconfig files
+// and finally Flags. Only per-file options may be set in filetype sections.
+func (s *Session) configure() {
+	if s.fileOpts == nil {
+		s.fileOpts = map[string]string{}
+		for _, opt := range options {
+			if opt.local {
+				s.fileOpts[opt.name] = opt.get(s)
+			}
+		}
+		s.setOptions("config", s.Config[""], false)
+		s.setOptions("flags", s.Flags, false)
+	}
+
+	s.setOptions("config", s.fileOpts, true)
+	s.setOptions("config", localOptions(s.Config[""]), true)
+	if ext := filepath.Ext(s.File); ext != "" {
+		s.setOptions("config: filetype."+ext[1:], s.Config["filetype."+ext[1:]], true)
+	}
+	if s.File != "" {
+		props, err := editorconfig.Find(s.File)
+		if err != nil {
+			s.Error("editorconfig: %v", err)
+		}
+		s.setOptions("editorconfig", editorconfigOptions(props), true)
+	}
+	s.setOptions("flags", localOptions(s.Flags), true)
+}
+
+// setOptions sets the per-file options in sec if local is true, or the
+// global ones otherwise, in name order. Per-file options are skipped when
+// setting global ones, but global options are an error when setting per-file
+// ones. Errors are reported prefixed with where.
+func (s *Session) setOptions(where string, sec map[string]string, local bool) {
+	var names []string
+	for name := range sec {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		opt := findOption(name)
+		var err error
+		if opt == nil {
+			err = fmt.Errorf("unknown option %q", name)
+		} else if opt.local == local {
+			err = opt.set(s, sec[name])
+		} else if local {
+			err = fmt.Errorf("%v is not a per-file option", opt.name)
+		}
+		if err != nil {
+			s.Error("%v: %v", where, err)
+		}
+	}
+}
+
+// localOptions returns the settings of per-file options in sec.
+func localOptions(sec map[string]string) map[string]string {
+	opts := map[string]string{}
+	for name, val := range sec {
+		if opt := findOption(name); opt != nil && opt.local {
+			opts[name] = val
+		}
+	}
+	return opts
+}
+
+// editorconfigOptions converts EditorConfig properties to option settings.
+// Unknown properties and values are ignored.
+func editorconfigOptions(props editorconfig.Properties) map[string]string {
+	opts := map[string]string{}
+	switch props["indent_style"] {
+	case "tab":
+		opts["expandtab"] = "false"
+	case "space":
+		opts["expandtab"] = "true"
+	}
+
+	// Tabwidth is both the width of tabs and the indent width, so when
+	// indenting with spaces the indent size wins.
+	size, width := props["indent_size"], props["tab_width"]
+	if size == "tab" {
+		size = width
+	}
+	if width == "" || (size != "" && opts["expandtab"] == "true") {
+		width = size
+	}
+	if n, err := strconv.Atoi(width); err == nil && n > 0 {
+		opts["tabwidth"] = width
+	}
+
+	if v := props["end_of_line"]; eols[v] != "" {
+		opts["endofline"] = v
+	}
+	if v := props["charset"]; v != "" && charsets[v] {
+		opts["charset"] = v
+	}
+	for prop, opt := range map[string]string{"trim_trailing_whitespace": "trimspace", "insert_final_newline": "finalnewline"} {
+		if v := props[prop]; v == "true" || v == "false" {
+			opts[opt] = v
+		}
+	}
+	return opts
+}
+
+// cmdSet implements :set. Each argument is one of
+//
+//	name        turn a boolean option on or show another option
+//	noname      turn a boolean option off
+//	name!       toggle a boolean option
+//	name?       show the option's value
+//	name=value  set the option
+//
+// With no arguments every option is shown.
+func cmdSet(s *Session, arg string, bang bool) error {
+	if arg == "" {
+		var vals []string
+		for _, opt := range options {
+			vals = append(vals, opt.name+"="+opt.get(s))
+		}
+		s.Info("%v", strings.Join(vals, " "))
+		return nil
+	}
+
+	var shown []string
+	for _, field := range strings.Fields(arg) {
+		name, val, hasVal := field, "", false
+		if i := strings.IndexAny(field, "=:"); i != -1 {
+			name, val, hasVal = field[:i], field[i+1:], true
+		}
+		show := strings.HasSuffix(name, "?")
+		toggle := strings.HasSuffix(name, "!")
+		name = strings.TrimRight(name, "?!")
+
+		opt := findOption(name)
+		off := false
+		if opt == nil && strings.HasPrefix(name, "no") {
+			opt, off = findOption(name[2:]), true
+		}
+		if opt == nil {
+			return fmt.Errorf("unknown option %q", name)
+		}
+
+		var err error
+		switch {
+		case show || (!hasVal && !opt.boolean):
+			shown = append(shown, opt.name+"="+opt.get(s))
+		case hasVal:
+			err = opt.set(s, val)
+		case !opt.boolean:
+			err = fmt.Errorf("%v is not a boolean option", opt.name)
+		case toggle:
+			err = opt.set(s, strconv.FormatBool(opt.get(s) != "true"))
+		default:
+			err = opt.set(s, strconv.FormatBool(!off))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(shown) > 0 {
+		s.Info("%v", strings.Join(shown, " "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/util"
+	"github.com/rwcarlsen/editor/view"
+)
+
+// drawer is implemented by modes that draw more than the buffer view. draw
+// is called by Session.Draw after the view has been drawn.
+type drawer interface {
+	draw(s *Session)
+}
+
+// prompt is a one line text input drawn on the bottom row of the terminal
+// after a prefix character.
+type prompt struct {
+	prefix rune
+	view   view.View
+	b      *util.Buffer
+	pos    int // byte offset of the cursor in b
+}
+
+func newPrompt(s *Session, prefix rune) *prompt {
+	p := &prompt{prefix: prefix, b: util.NewBuffer([]byte{})}
+	p.view = &view.Wrap{}
+	p.view.SetBuf(p.b)
+	p.view.SetSize(s.W-1, 1)
+	p.view.SetTabwidth(1)
+	return p
+}
+
+// handleKey applies ev to the prompt text and reports whether ev was an
+// editing key.
+func (p *prompt) handleKey(ev termbox.Event) bool {
+	if ev.Ch != 0 {
+		p.pos += p.b.Insert(p.pos, ev.Ch)
+		return true
+	}
+
+	switch ev.Key {
+	case termbox.KeySpace:
+		p.pos += p.b.Insert(p.pos, ' ')
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		p.pos -= p.b.Delete(p.pos, -1)
+	case termbox.KeyDelete:
+		p.b.Delete(p.pos, 1)
+	case termbox.KeyArrowLeft:
+		_, size := p.b.RuneBefore(p.pos)
+		p.pos -= size
+	case termbox.KeyArrowRight:
+		_, size := p.b.RuneAt(p.pos)
+		p.pos += size
+	case termbox.KeyHome, termbox.KeyCtrlA:
+		p.pos = 0
+	case termbox.KeyEnd, termbox.KeyCtrlE:
+		p.pos = p.b.Len()
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *prompt) text() string { return string(p.b.Bytes()) }
+
+// setText replaces the prompt text and moves the cursor to its end.
+func (p *prompt) setText(text string) {
+	p.b.Replace(0, p.b.Len(), []byte(text))
+	p.pos = p.b.Len()
+}
+
+// draw draws the prompt on the bottom row of the terminal and places the
+// terminal cursor in it.
+func (p *prompt) draw(s *Session) {
+	termbox.SetCell(0, s.H, p.prefix, 0, 0)
+	view.Draw(p.view.Render(), 1, s.H)
+	_, char := p.b.Pos(p.pos)
+	termbox.SetCursor(1+char, s.H)
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"bytes"
+	"unicode"
+
+	"github.com/rwcarlsen/editor/util"
+)
+
+// Unnamed is the name of the register that receives every yank and delete.
+const Unnamed = '"'
+
+// Register holds text that was yanked or deleted.
+type Register struct {
+	Text []byte
+	// Linewise is true if Text consists of whole lines.
+	Linewise bool
+}
+
+// Registers maps register names to their contents. Besides the unnamed
+// register, the named registers a-z are available.
+type Registers map[rune]*Register
+
+// ValidRegister returns true if r names a register. Uppercase names refer to
+// the same registers as lowercase ones but append to them instead of
+// replacing their contents.
+func ValidRegister(r rune) bool {
+	r = unicode.ToLower(r)
+	return r == Unnamed || (r >= 'a' && r <= 'z')
+}
+
+// SelectRegister makes the next yank, delete or put use register r rather
+// than only the unnamed register.
+func (s *Session) SelectRegister(r rune) { s.register = r }
+
+// Yank stores a copy of text in the unnamed register and in the selected
+// register if there is one.
+func (s *Session) Yank(text []byte, linewise bool) {
+	if s.Regs == nil {
+		s.Regs = Registers{}
+	}
+
+	reg := &Register{Text: append([]byte{}, text...), Linewise: linewise}
+	name := unicode.ToLower(s.register)
+	if old := s.Regs[name]; old != nil && unicode.IsUpper(s.register) {
+		reg = old.join(reg)
+	}
+	if name != 0 {
+		s.Regs[name] = reg
+	}
+	s.Regs[Unnamed] = reg
+	s.register = 0
+}
+
+// join returns a register holding the contents of r followed by those of
+// next. If either is linewise, so is the result.
+func (r *Register) join(next *Register) *Register {
+	if !r.Linewise && !next.Linewise {
+		return &Register{Text: append(append([]byte{}, r.Text...), next.Text...)}
+	}
+	text := append([]byte{}, r.Text...)
+	if !bytes.HasSuffix(text, []byte("\n")) {
+		text = append(text, '\n')
+	}
+	text = append(text, next.Text...)
+	if !bytes.HasSuffix(text, []byte("\n")) {
+		text = append(text, '\n')
+	}
+	return &Register{Text: text, Linewise: true}
+}
+
+// Put inserts the contents of the selected register n times after the
+// cursor, or before it if before is true. Linewise registers are put on the
+// lines below or above the cursor's.
+func (s *Session) Put(before bool, n int) {
+	name := unicode.ToLower(s.register)
+	if name == 0 {
+		name = Unnamed
+	}
+	s.register = 0
+	reg := s.Regs[name]
+	if reg == nil || len(reg.Text) == 0 {
+		return
+	}
+	text := bytes.Repeat(reg.Text, util.Max(n, 1))
+
+	offset := s.Buf.Offset(s.CursorL, s.CursorC)
+	if reg.Linewise {
+		if !bytes.HasSuffix(text, []byte("\n")) {
+			text = append(text, '\n')
+		}
+		line := s.CursorL
+		if !before {
+			line++
+		}
+		offset = s.Buf.Offset(line, 0)
+		if r, size := s.Buf.RuneBefore(offset); size > 0 && r != '\n' {
+			// the last line has no newline of its own
+			text = append([]byte("\n"), text[:len(text)-1]...)
+		}
+		s.Replace(offset, offset, text)
+		if text[0] == '\n' {
+			offset++
+		}
+		s.SetCursor(s.Buf.Pos(util.FirstNonBlank(s.Buf, offset)))
+		return
+	}
+
+	if r, size := s.Buf.RuneAt(offset); !before && size > 0 && r != '\n' {
+		offset += size
+	}
+	s.SetCursor(s.Buf.Pos(offset))
+	s.Insert([]rune(string(text))...)
+	_, size := s.Buf.RuneBefore(offset + len(text))
+	s.SetCursor(s.Buf.Pos(offset + len(text) - size))
+}
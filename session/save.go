@@ -0,0 +1,143 @@
+package session
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Save writes the buffer to the named file in the session's Charset and EOL,
+// fixing whitespace as TrimSpace and FinalNewline ask. Saving to the
+// session's file fixes the buffer itself and marks it as clean; other files
+// get a fixed copy and the buffer is left alone.
+func (s *Session) Save(file string) error {
+	data := s.Buf.Bytes()
+	if file == s.File {
+		s.fixWhitespace()
+		data = s.Buf.Bytes()
+	} else {
+		data = s.fixedWhitespace(data)
+	}
+	data, err := encode(data, s.Charset, s.EOL)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(file, data, s.Backup); err != nil {
+		return err
+	}
+	if file == s.File {
+		s.saved = s.hist.state()
+	}
+	return nil
+}
+
+// ctrlS handles the Ctrl-S key by saving the buffer to the session's file.
+// A failed save is reported as a message.
+func (s *Session) ctrlS() {
+	if s.File == "" {
+		s.Error("no file name (use :saveas)")
+	} else if err := s.Save(s.File); err != nil {
+		s.Error("%v", err)
+	} else {
+		s.Info("%q written", s.File)
+	}
+}
+
+// writeFile replaces the named file with data without ever leaving it
+// partially written: data is written and synced to a temporary file in the
+// same directory which is then renamed over the original. Symlinks are
+// followed so that their target is replaced rather than the link itself, and
+// the original file's permissions and (where possible) owner are kept; new
+// files are created with mode 0666 less the umask. If backup is true, the
+// previous contents are kept in a file of the same name with a '~' appended.
+func writeFile(path string, data []byte, backup bool) (err error) {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err == nil && backup {
+		if err := backupFile(path, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	perm := os.FileMode(0666)
+	if fi != nil {
+		perm = 0600 // until it is given the original's mode
+	}
+	f, err := createTemp(dir, "."+base+".", perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	} else if err = f.Sync(); err != nil {
+		return err
+	}
+	if fi != nil {
+		if err = f.Chmod(fi.Mode().Perm()); err != nil {
+			return err
+		}
+		chown(f, fi) // best effort; only privileged users can give files away
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// createTemp is like ioutil.TempFile but creates the file with perm, less
+// the umask, instead of 0600.
+func createTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%v%v.%v", prefix, os.Getpid(), i))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// backupFile keeps the current contents of path in path~. A hard link is used
+// if possible so that the backup is the very file being replaced.
+func backupFile(path string, perm os.FileMode) error {
+	bak := path + "~"
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bak, data, perm)
+}
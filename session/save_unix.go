@@ -0,0 +1,17 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package session
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives f the owner and group recorded in fi.
+func chown(f *os.File, fi os.FileInfo) error {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return f.Chown(int(st.Uid), int(st.Gid))
+	}
+	return nil
+}
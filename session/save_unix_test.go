@@ -0,0 +1,48 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := syscall.Umask(077)
+	defer syscall.Umask(old)
+
+	// new files get 0666 less the umask
+	path := filepath.Join(dir, "new")
+	if err := writeFile(path, []byte("x\n"), false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("new file: expected mode 0600, got %o", perm)
+	}
+
+	// existing files keep their mode
+	path = filepath.Join(dir, "old")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(path, 0754)
+	if err := writeFile(path, []byte("x\n"), false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if perm := fi.Mode().Perm(); perm != 0754 {
+		t.Errorf("existing file: expected mode 0754, got %o", perm)
+	}
+}
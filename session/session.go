@@ -3,9 +3,16 @@ package session
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
 	"regexp"
+	"sort"
+	"time"
 
 	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/config"
+	"github.com/rwcarlsen/editor/highlight"
+	"github.com/rwcarlsen/editor/theme"
 	"github.com/rwcarlsen/editor/util"
 	"github.com/rwcarlsen/editor/view"
 )
@@ -30,22 +37,65 @@ type Session struct {
 	Matches     [][]int // regexp search matches
 	Tabwidth    int
 	Ypivot      int
+	Regs        Registers
+	StateFile   string // file registers and search history are kept in between sessions
+	Backup      bool   // keep the previous contents of a saved file in file~
+	Theme       *theme.Theme
+	Config      config.Config     // option settings from the config file
+	Flags       map[string]string // option settings from the command line; override Config
+	Bindings    string            // key bindings: "vi" (the default) or "emacs"
+	keymaps     map[string]*Keymap
+	hist        History
+	register    rune // register selected for the next yank or put
+	saved       int  // history state when the buffer was last saved
+	quitArmed   bool // true if Ctrl-Q was refused on the last key press
+	nohl        bool // true if search matches are not highlighted
+	searchBack  bool // true if the last search was backward
+	searchHist  []string
+	lastFind    charSearch // last f, t, F or T search, repeated by ; and ,
+	// Log, if not nil, receives every message shown.
+	Log       *log.Logger
+	msgs      []Message // message history, oldest first
+	msg       *Message  // message on the status line, or nil
+	msgExpire time.Time
+	msgTimer  *time.Timer // wakes the event loop to expire msg
+
+	// fileOpts holds the values of per-file options before any file was
+	// configured.
+	fileOpts map[string]string
+
+	// How files are written; see Save.
+	Charset      string // file encoding: utf-8, utf-8-bom, latin1, utf-16le, utf-16be or "" for unchanged
+	EOL          string // line ending: lf, crlf, cr or "" for unchanged
+	TrimSpace    bool   // remove trailing whitespace on save
+	FinalNewline bool   // end the file with a newline on save
 }
 
 func (s *Session) Run() error {
-	s.mode = &ModeEdit{}
-	data, err := ioutil.ReadFile(s.File)
-	if err != nil {
-		return err
+	s.mode = s.baseMode()
+	if err := s.loadState(); err != nil {
+		s.Error("loading state: %v", err)
 	}
-	s.Buf = util.NewBuffer(data)
+	if s.Theme == nil {
+		s.Theme = theme.Default
+	}
+	termbox.SetOutputMode(s.Theme.OutputMode())
 	s.W, s.H = termbox.Size()
 	s.H--
-	s.View.SetBuf(s.Buf)
 	s.View.SetSize(s.W, s.H)
 	s.View.SetTabwidth(s.Tabwidth)
+	if s.Buf == nil {
+		if err := s.Open(s.File); err != nil {
+			return err
+		}
+	} else {
+		s.View.SetBuf(s.Buf)
+	}
 
+	var err error
 	for {
+		s.setInputMode()
+		s.expireMsg()
 		s.Draw()
 		termbox.Flush()
 		termbox.Clear(0, 0)
@@ -53,20 +103,118 @@ func (s *Session) Run() error {
 		ev := termbox.PollEvent()
 		switch ev.Type {
 		case termbox.EventKey:
+			s.quitArmed = s.quitArmed && ev.Key == termbox.KeyCtrlQ
 			s.mode, err = s.mode.HandleKey(s, ev)
-			if err != nil {
+			if err == ErrQuit {
+				if err := s.saveState(); err != nil {
+					return err
+				}
+				return ErrQuit
+			} else if err != nil {
 				return err
 			}
 		case termbox.EventResize:
 			s.W, s.H = ev.Width, ev.Height-1
 			s.View.SetSize(s.W, s.H)
 		case termbox.EventMouse:
+		case termbox.EventInterrupt:
+			// redraw to clear an expired message
 		case termbox.EventError:
 			return ev.Err
 		}
 	}
 }
 
+// Open replaces the session's buffer with the contents of the named file. If
+// the file doesn't exist, the buffer starts out empty and the file is created
+// when it is first saved. An empty name opens an unnamed scratch buffer and
+// "-" reads the buffer from standard input; keyboard input is unaffected
+// since termbox reads it from the terminal rather than from stdin.
+func (s *Session) Open(file string) error {
+	var data []byte
+	var err error
+	switch file {
+	case "":
+	case "-":
+		data, err = ioutil.ReadAll(os.Stdin)
+		file = ""
+	default:
+		data, err = ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			err = nil
+			s.Info("%q [New File]", file)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.File = file
+	s.configure()
+	if data, err = decode(data, s.Charset, s.EOL); err != nil {
+		return err
+	}
+	s.Buf = util.NewBuffer(data)
+	if lex := highlight.ForFile(file); lex != nil {
+		h := highlight.New(s.Buf, lex)
+		h.Colors = func(c highlight.Class) (fg, bg termbox.Attribute) { return s.attr(c.String()) }
+		s.Buf.SetStyler(h)
+	}
+	s.View.SetBuf(s.Buf)
+	s.hist = History{}
+	s.saved = 0
+	s.CursorL, s.CursorC, s.Ypivot = 0, 0, 0
+	s.UpdSearch()
+	return nil
+}
+
+// setInputMode makes termbox report Esc followed quickly by another key as
+// an Alt-modified key if the emacs bindings, which use Alt, are in use. The vi
+// bindings need Esc to be seen as Esc however quickly the next key follows.
+func (s *Session) setInputMode() {
+	mode := termbox.InputEsc
+	if s.Bindings == "emacs" {
+		mode = termbox.InputAlt
+	}
+	if termbox.SetInputMode(termbox.InputCurrent) != mode {
+		termbox.SetInputMode(mode)
+	}
+}
+
+// baseMode returns the mode other modes return to when they are done: edit
+// mode, or emacs mode if Bindings is "emacs".
+func (s *Session) baseMode() Mode {
+	if s.Bindings == "emacs" {
+		return &ModeEmacs{}
+	}
+	return &ModeEdit{}
+}
+
+// Dirty returns true if the buffer differs from what was last saved or
+// opened.
+func (s *Session) Dirty() bool { return s.hist.state() != s.saved }
+
+// Quit returns ErrQuit, or an error explaining why not if the buffer has
+// unsaved changes and force is false.
+func (s *Session) Quit(force bool) error {
+	if s.Dirty() && !force {
+		return fmt.Errorf("no write since last change")
+	}
+	return ErrQuit
+}
+
+// ctrlQ handles the Ctrl-Q key. A dirty buffer is only abandoned if Ctrl-Q is
+// pressed twice in a row.
+func (s *Session) ctrlQ() error {
+	err := s.Quit(s.quitArmed)
+	if err != ErrQuit {
+		s.Warn("%v (press Ctrl-Q again to quit)", err)
+		s.quitArmed = true
+		return nil
+	}
+	return err
+}
+
 func (s *Session) SetCursor(line, char int) {
 	if char < 0 {
 		char = s.CursorC
@@ -75,6 +223,8 @@ func (s *Session) SetCursor(line, char int) {
 		line = s.CursorL
 	}
 
+	// the buffer may have shrunk past the cursor since it was last set
+	s.CursorL = util.Max(util.Min(s.CursorL, s.Buf.Nlines()-1), 0)
 	s.View.SetRef(s.CursorL, 0, 0, s.Ypivot)
 	surf := s.View.Render()
 
@@ -96,21 +246,45 @@ func (s *Session) SetCursor(line, char int) {
 	s.CursorC = char
 }
 
+// Delete removes n characters at the cursor. If n is negative, the characters
+// before the cursor are removed instead.
 func (s *Session) Delete(n int) {
 	offset := s.Buf.Offset(s.CursorL, s.CursorC)
-	nb := s.Buf.Delete(offset, n)
-	s.SetCursor(s.Buf.Pos(offset - nb))
-	s.UpdSearch()
+	start, end := s.Buf.Span(offset, n)
+	s.Replace(start, end, nil)
 }
 
+// Insert adds chs to the buffer at the cursor.
 func (s *Session) Insert(chs ...rune) {
 	offset := s.Buf.Offset(s.CursorL, s.CursorC)
-	n := s.Buf.Insert(offset, chs...)
-	s.SetCursor(s.Buf.Pos(offset + n))
+	s.Replace(offset, offset, []byte(string(chs)))
+}
+
+// Replace substitutes text for the bytes in the range [start, end), records
+// the change in the undo history and moves the cursor to the end of the
+// inserted text.
+func (s *Session) Replace(start, end int, text []byte) {
+	if start == end && len(text) == 0 {
+		return
+	}
+	c := &change{
+		offset:   start,
+		removed:  s.Buf.Slice(start, end),
+		inserted: append([]byte{}, text...),
+		beforeL:  s.CursorL,
+		beforeC:  s.CursorC,
+	}
+	s.Buf.Replace(start, end, text)
+	s.SetCursor(s.Buf.Pos(start + len(text)))
+	c.afterL, c.afterC = s.CursorL, s.CursorC
+	s.hist.record(c)
 	s.UpdSearch()
 }
 
 func (s *Session) Draw() {
+	if ln, ok := s.View.(*view.LineNum); ok {
+		ln.GutterFg, ln.GutterBg = s.attr("gutter")
+	}
 	s.View.SetRef(s.CursorL, 0, 0, s.Ypivot)
 	surf := s.View.Render()
 
@@ -120,22 +294,144 @@ func (s *Session) Draw() {
 
 	// draw content
 	view.Draw(surf, 0, 0)
+	if fg, bg := s.attr("cursorline"); fg != 0 || bg != 0 {
+		view.Mark(surf, 0, 0, func(l, ch int) bool { return l == s.CursorL }, fg, bg)
+	}
+	if !s.nohl {
+		s.drawMatches(surf)
+	}
+	if sel, ok := s.mode.(selector); ok {
+		fg, bg := s.attr("selection")
+		if fg == 0 && bg == 0 {
+			fg = termbox.AttrReverse
+		}
+		view.Mark(surf, 0, 0, sel.selection(s), fg, bg)
+	}
+
+	if d, ok := s.mode.(drawer); ok {
+		d.draw(s)
+	} else {
+		s.drawStatus()
+	}
+}
+
+// drawMatches highlights the search matches visible on surf. The match the
+// cursor is in is drawn in its own colour.
+func (s *Session) drawMatches(surf view.Surface) {
+	first, last := view.Lines(surf)
+	if first == -1 || len(s.Matches) == 0 {
+		return
+	}
+	start, end := s.Buf.Offset(first, 0), s.Buf.Len()
+	if last+1 < s.Buf.Nlines() {
+		end = s.Buf.Offset(last+1, 0)
+	}
+	cursor := s.Buf.Offset(s.CursorL, s.CursorC)
+
+	i := sort.Search(len(s.Matches), func(i int) bool { return s.Matches[i][1] > start })
+	for _, m := range s.Matches[i:] {
+		if m[0] >= end {
+			break
+		}
+		class := "search"
+		if m[0] <= cursor && cursor < m[1] {
+			class = "match"
+		}
+		fg, bg := s.attr(class)
+		if fg == 0 && bg == 0 {
+			fg = termbox.AttrReverse
+		}
+		view.MarkRange(surf, 0, 0, s.Buf, m[0], m[1], fg, bg)
+	}
+}
+
+// attr returns the attributes the session's theme gives class.
+func (s *Session) attr(class string) (fg, bg termbox.Attribute) {
+	if s.Theme == nil {
+		return theme.Default.Attr(class)
+	}
+	return s.Theme.Attr(class)
 }
 
+// SetTheme makes the session draw with t.
+func (s *Session) SetTheme(t *theme.Theme) {
+	s.Theme = t
+	termbox.SetOutputMode(t.OutputMode())
+}
+
+// NextMatch moves the cursor to the next search match in the direction of the
+// last search.
 func (s *Session) NextMatch() {
 	if len(s.Matches) > 0 {
 		cursor := s.Buf.Offset(s.CursorL, s.CursorC)
-		n := 0
-		for i, match := range s.Matches {
-			offset := match[0]
-			if offset > cursor {
-				n = i
-				break
+		s.SetCursor(s.Buf.Pos(s.nextMatch(cursor, s.searchBack)))
+	}
+}
+
+// nextMatch returns the offset of the first search match after offset, or
+// before it if back is true, wrapping around the ends of the buffer. If there
+// are no matches, offset is returned.
+func (s *Session) nextMatch(offset int, back bool) int {
+	s.nohl = false
+	if len(s.Matches) == 0 {
+		if s.Search != nil {
+			s.Error("pattern not found: %v", s.Search)
+		}
+		return offset
+	}
+	match, wrapped := s.findMatch(offset, back)
+	if wrapped {
+		s.warnWrap(back)
+	}
+	return match
+}
+
+// findMatch is like nextMatch without messages. wrapped is true if the
+// search went around an end of the buffer.
+func (s *Session) findMatch(offset int, back bool) (match int, wrapped bool) {
+	if len(s.Matches) == 0 {
+		return offset, false
+	}
+	if back {
+		for i := len(s.Matches) - 1; i >= 0; i-- {
+			if s.Matches[i][0] < offset {
+				return s.Matches[i][0], false
 			}
+		}
+		return s.Matches[len(s.Matches)-1][0], true
+	}
+	for _, match := range s.Matches {
+		if match[0] > offset {
+			return match[0], false
+		}
+	}
+	return s.Matches[0][0], true
+}
 
+// warnWrap tells that a search went around the end of the buffer.
+func (s *Session) warnWrap(back bool) {
+	if back {
+		s.Warn("search hit TOP, continuing at BOTTOM")
+	} else {
+		s.Warn("search hit BOTTOM, continuing at TOP")
+	}
+}
+
+// maxSearchHist is the number of searches kept in the search history.
+const maxSearchHist = 100
+
+// addSearchHist appends pattern to the search history, removing any earlier
+// copy of it.
+func (s *Session) addSearchHist(pattern string) {
+	for i, p := range s.searchHist {
+		if p == pattern {
+			s.searchHist = append(s.searchHist[:i], s.searchHist[i+1:]...)
+			break
 		}
-		offset := s.Matches[n][0]
-		s.SetCursor(s.Buf.Pos(offset))
+	}
+	s.searchHist = append(s.searchHist, pattern)
+	if len(s.searchHist) > maxSearchHist {
+		s.searchHist = s.searchHist[len(s.searchHist)-maxSearchHist:]
 	}
 }
 
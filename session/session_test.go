@@ -0,0 +1,280 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/config"
+	"github.com/rwcarlsen/editor/util"
+	"github.com/rwcarlsen/editor/view"
+)
+
+func newTestSession(text string) *Session {
+	s := &Session{View: &view.Wrap{}, Tabwidth: 4, W: 20, H: 5}
+	s.Buf = util.NewBuffer([]byte(text))
+	s.View.SetBuf(s.Buf)
+	s.View.SetSize(s.W, s.H)
+	s.View.SetTabwidth(s.Tabwidth)
+	return s
+}
+
+// feed sends keys to s as if typed: \x1b is Esc, \r is Enter and other
+// control characters are the matching Ctrl keys.
+func feed(t *testing.T, s *Session, keys string) {
+	t.Helper()
+	if s.mode == nil {
+		s.mode = &ModeEdit{}
+	}
+	for _, ch := range keys {
+		ev := termbox.Event{Type: termbox.EventKey, Ch: ch}
+		switch {
+		case ch == '\x1b':
+			ev = termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc}
+		case ch == '\r':
+			ev = termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter}
+		case ch < ' ':
+			ev = termbox.Event{Type: termbox.EventKey, Key: termbox.Key(ch)}
+		}
+		var err error
+		if s.mode, err = s.mode.HandleKey(s, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expect(t *testing.T, s *Session, text string, l, c int) {
+	t.Helper()
+	if got := string(s.Buf.Bytes()); got != text || s.CursorL != l || s.CursorC != c {
+		t.Fatalf("expected %q at %v,%v, got %q at %v,%v", text, l, c, got, s.CursorL, s.CursorC)
+	}
+}
+
+func TestDeleteLines(t *testing.T) {
+	tests := []struct {
+		text, keys, expect string
+	}{
+		{strings.Repeat("x\n", 10), "Gdgg", ""},
+		{"1\n2\n3\n4\n", "3Gdgg", "4\n"},
+		{"1\n2\n3\n4\n", "2GdG", "1\n"},
+	}
+	for _, test := range tests {
+		s := newTestSession(test.text)
+		feed(t, s, test.keys)
+		expect(t, s, test.expect, 0, 0)
+	}
+}
+
+func TestUndoShrink(t *testing.T) {
+	s := newTestSession("a\n")
+	feed(t, s, "yy9pG")
+	expect(t, s, strings.Repeat("a\n", 10), 9, 0)
+	feed(t, s, "u")
+	expect(t, s, "a\n", 0, 0)
+	feed(t, s, "\x12") // Ctrl-R
+	if got := string(s.Buf.Bytes()); got != strings.Repeat("a\n", 10) {
+		t.Fatalf("redo: expected ten lines, got %q", got)
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	tests := []struct {
+		text, keys, expect string
+	}{
+		{"abc\n", "/zzz\r", "pattern not found: zzz"},
+		{"b\na\nb\n", "G/b\r", "search hit BOTTOM, continuing at TOP"},
+		{"b\na\n", "?b\r", "search hit TOP, continuing at BOTTOM"},
+	}
+	for _, test := range tests {
+		s := newTestSession(test.text)
+		feed(t, s, test.keys)
+		if len(s.msgs) != 1 || s.msgs[0].Text != test.expect {
+			t.Errorf("%q: expected the message %q, got %v", test.keys, test.expect, s.msgs)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "sub", "state.json")
+	s := newTestSession("foo bar\n")
+	s.StateFile = file
+	feed(t, s, "yw/bar\r")
+	if err := s.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestSession("")
+	s.StateFile = file
+	if err := s.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if reg := s.Regs[Unnamed]; reg == nil || string(reg.Text) != "foo " {
+		t.Errorf("expected the unnamed register to hold %q, got %v", "foo ", reg)
+	}
+	if len(s.searchHist) != 1 || s.searchHist[0] != "bar" {
+		t.Errorf("expected search history [bar], got %v", s.searchHist)
+	}
+}
+
+func TestExecSamRange(t *testing.T) {
+	tests := []struct {
+		cmd, expect string
+	}{
+		{"2,3d", "1\n4\n"},
+		{".d", "1\n3\n4\n"},
+		{"d", "1\n3\n4\n"},
+		{"2,3x/[0-9]/c/x/", "1\nx\nx\n4\n"},
+	}
+	for _, test := range tests {
+		s := newTestSession("1\n2\n3\n4\n")
+		s.SetCursor(1, 0)
+		if err := s.ExecCommand(test.cmd); err != nil {
+			t.Errorf("%v: %v", test.cmd, err)
+		} else if got := string(s.Buf.Bytes()); got != test.expect {
+			t.Errorf("%v: expected %q, got %q", test.cmd, test.expect, got)
+		}
+	}
+}
+
+func TestConfigureReset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a/.editorconfig": "root = true\n[*]\nindent_style = space\nindent_size = 2\nend_of_line = crlf\n",
+		"a/x.py":          "x = 1\n",
+		"b/.editorconfig": "root = true\n",
+		"b/y.go":          "package y\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestSession("")
+	s.Config = config.Config{"filetype.py": {"trimspace": "true"}}
+	tests := []struct {
+		file string
+		opts map[string]string
+	}{
+		{"a/x.py", map[string]string{"expandtab": "true", "tabwidth": "2", "endofline": "crlf", "trimspace": "true"}},
+		{"b/y.go", map[string]string{"expandtab": "false", "tabwidth": "4", "endofline": "", "trimspace": "false"}},
+	}
+	for _, tst := range tests {
+		if err := s.Open(filepath.Join(dir, tst.file)); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range tst.opts {
+			if got, _ := s.Option(name); got != want {
+				t.Errorf("%v: expected %v=%v, got %v", tst.file, name, want, got)
+			}
+		}
+	}
+}
+
+func TestMapList(t *testing.T) {
+	s := newTestSession("x\n")
+	s.mode = &ModeEdit{}
+	if err := s.ExecCommand("map"); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := s.mode.(*ModeList)
+	if !ok {
+		t.Fatalf("expected a list of bindings, got %T", s.mode)
+	} else if len(s.msgs) != 0 {
+		t.Errorf("expected no messages, got %v", len(s.msgs))
+	}
+	pages := (len(m.lines) + s.H - 1) / s.H
+	for i := 0; i < pages; i++ {
+		if _, ok := s.mode.(*ModeList); !ok {
+			t.Fatalf("expected %v pages, left the list after %v", pages, i)
+		}
+		feed(t, s, " ")
+	}
+	if _, ok := s.mode.(*ModeEdit); !ok {
+		t.Errorf("expected edit mode after the last page, got %T", s.mode)
+	}
+}
+
+func TestConfigureGlobal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestSession("")
+	s.Config = config.Config{"": {"backup": "false", "tabwidth": "8"}}
+	if err := s.Open(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"set backup tabwidth=2", "e " + filepath.Join(dir, "b.txt")} {
+		if err := s.ExecCommand(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := s.Option("backup"); got != "true" {
+		t.Errorf("expected backup=true to survive :e, got %v", got)
+	}
+	if got, _ := s.Option("tabwidth"); got != "8" {
+		t.Errorf("expected tabwidth=8 from the config for the new file, got %v", got)
+	}
+}
+
+func TestSaveWhitespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestSession("a  \nb")
+	s.File = filepath.Join(dir, "a.txt")
+	s.TrimSpace, s.FinalNewline = true, true
+	for _, file := range []string{"copy.txt", "a.txt"} {
+		path := filepath.Join(dir, file)
+		if err := s.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ioutil.ReadFile(path); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "a\nb\n" {
+			t.Errorf("%v: expected %q written, got %q", file, "a\nb\n", data)
+		}
+		if file == "copy.txt" {
+			if got := string(s.Buf.Bytes()); got != "a  \nb" || len(s.hist.undo) != 0 {
+				t.Errorf("expected the buffer unchanged by writing a copy, got %q with %v undo groups", got, len(s.hist.undo))
+			}
+		}
+	}
+	if got := string(s.Buf.Bytes()); got != "a\nb\n" || len(s.hist.undo) != 1 {
+		t.Errorf("expected the buffer fixed in one undo group, got %q with %v groups", got, len(s.hist.undo))
+	}
+}
+
+func TestChangeStart(t *testing.T) {
+	s := newTestSession("a foo\nb bar\n")
+	feed(t, s, "jwcw")
+	if m, ok := s.mode.(*ModeInsert); !ok || m.start != 8 {
+		t.Fatalf("expected insert mode starting at 8, got %#v", s.mode)
+	}
+	feed(t, s, "xy\x1b")
+	expect(t, s, "a foo\nb xy\n", 1, 3)
+}
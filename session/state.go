@@ -0,0 +1,78 @@
+package session
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// state is the part of a session that is kept between runs in the session's
+// StateFile: the registers and the search history.
+type state struct {
+	Registers map[string]savedRegister
+	Searches  []string `json:",omitempty"`
+}
+
+type savedRegister struct {
+	Text     string
+	Linewise bool
+}
+
+// DefaultStateFile returns the path of the state file in the user's cache
+// directory, or "" if there is none.
+func DefaultStateFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "editor", "state.json")
+}
+
+// loadState restores the saved session state if there is a state file.
+func (s *Session) loadState() error {
+	if s.StateFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	if s.Regs == nil {
+		s.Regs = Registers{}
+	}
+	for name, reg := range st.Registers {
+		if r := []rune(name); len(r) == 1 && ValidRegister(r[0]) {
+			s.Regs[r[0]] = &Register{Text: []byte(reg.Text), Linewise: reg.Linewise}
+		}
+	}
+	s.searchHist = st.Searches
+	return nil
+}
+
+// saveState writes the session state to the state file if there is one.
+func (s *Session) saveState() error {
+	if s.StateFile == "" {
+		return nil
+	}
+
+	st := state{Registers: map[string]savedRegister{}, Searches: s.searchHist}
+	for name, reg := range s.Regs {
+		st.Registers[string(name)] = savedRegister{string(reg.Text), reg.Linewise}
+	}
+	data, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.StateFile), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.StateFile, data, 0600)
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"fmt"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/view"
+)
+
+// namer is implemented by modes that are named on the status line.
+type namer interface {
+	Name() string
+}
+
+func (m *ModeEdit) Name() string    { return "EDIT" }
+func (m *ModeInsert) Name() string  { return "INSERT" }
+func (m *ModeSearch) Name() string  { return "SEARCH" }
+func (m *ModeCommand) Name() string { return "COMMAND" }
+func (m *ModeConfirm) Name() string { return "CONFIRM" }
+func (m *ModeEmacs) Name() string   { return "EMACS" }
+
+func (m *ModeVisual) Name() string {
+	switch m.Kind {
+	case VisualLine:
+		return "VISUAL LINE"
+	case VisualBlock:
+		return "VISUAL BLOCK"
+	}
+	return "VISUAL"
+}
+
+// drawStatus draws the status line on the bottom row of the terminal: the
+// file name, the modified flag and any message on the left, and the mode
+// name, cursor position and how far through the file it is on the right.
+func (s *Session) drawStatus() {
+	fg, bg := s.attr("status")
+	for x := 0; x < s.W; x++ {
+		termbox.SetCell(x, s.H, ' ', fg, bg)
+	}
+
+	name := ""
+	if n, ok := s.mode.(namer); ok {
+		name = n.Name()
+	}
+	col := view.NewTabber(s.Buf.Line(s.CursorL), s.Tabwidth).ChToX[s.CursorC] + 1
+	pct := 100 * (s.CursorL + 1) / s.Buf.Nlines()
+	right := fmt.Sprintf("  %v  %v:%v  %3v%% ", name, s.CursorL+1, col, pct)
+	x := s.W - len(right)
+	for _, ch := range right {
+		termbox.SetCell(x, s.H, ch, fg, bg)
+		x++
+	}
+
+	left := s.File
+	if left == "" {
+		left = "[No Name]"
+	}
+	if s.Dirty() {
+		left += " [+]"
+	}
+	x = s.drawText(0, left+"  ", fg, bg, s.W-len(right))
+	if s.msg != nil {
+		mfg, mbg := s.msgAttr(s.msg.Level)
+		s.drawText(x, s.msg.Text, mfg, mbg, s.W-len(right))
+	}
+}
+
+// drawText draws text on the status line from x up to but not including
+// column max and returns the column after it.
+func (s *Session) drawText(x int, text string, fg, bg termbox.Attribute, max int) int {
+	for _, ch := range text {
+		if x >= max {
+			break
+		}
+		termbox.SetCell(x, s.H, ch, fg, bg)
+		x++
+	}
+	return x
+}
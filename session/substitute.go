@@ -0,0 +1,208 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/util"
+)
+
+// substitution replaces the bytes [start, end) of the buffer with text.
+type substitution struct {
+	start, end int
+	text       []byte
+}
+
+// cmdSubstitute implements :s/pattern/replacement/flags. The replacement may
+// refer to submatches as in regexp.Expand. With the g flag every match in a
+// line is replaced rather than only the first, i makes the pattern case
+// insensitive and c asks before each replacement.
+func cmdSubstitute(s *Session, first, last int, arg string, bang bool) error {
+	pattern, repl, flags, err := splitSubstitute(arg)
+	if err != nil {
+		return err
+	}
+	var global, confirm, fold bool
+	for _, f := range flags {
+		switch f {
+		case 'g':
+			global = true
+		case 'c':
+			confirm = true
+		case 'i':
+			fold = true
+		default:
+			return fmt.Errorf("invalid flag %q", f)
+		}
+	}
+
+	var re *regexp.Regexp
+	if pattern == "" {
+		if s.Search == nil {
+			return fmt.Errorf("no previous regular expression")
+		}
+		re = s.Search
+	} else {
+		if fold {
+			pattern = "(?i)" + pattern
+		}
+		if re, err = regexp.Compile(pattern); err != nil {
+			return err
+		}
+		s.addSearchHist(pattern)
+	}
+	s.Search, s.searchBack, s.nohl = re, false, false
+	s.UpdSearch()
+
+	subs := s.substitutions(re, []byte(repl), first, last, global)
+	if len(subs) == 0 {
+		return fmt.Errorf("pattern not found: %v", re)
+	}
+	if confirm {
+		s.StartGroup()
+		m := &ModeConfirm{subs: subs}
+		m.next(s)
+		s.mode = m
+		return nil
+	}
+
+	lastStart := s.replaceAll(subs)
+	s.SetCursor(s.Buf.Pos(util.FirstNonBlank(s.Buf, lastStart)))
+	s.Info("%d substitutions", len(subs))
+	return nil
+}
+
+// replaceAll makes subs, which must be sorted and not overlap, as a single
+// edit. It returns the offset the last substitution starts at afterwards.
+func (s *Session) replaceAll(subs []substitution) (lastStart int) {
+	start, end := subs[0].start, subs[len(subs)-1].end
+	var text []byte
+	prev, delta := start, 0
+	for _, sub := range subs {
+		text = append(text, s.Buf.Slice(prev, sub.start)...)
+		text = append(text, sub.text...)
+		prev = sub.end
+		lastStart = sub.start + delta
+		delta += len(sub.text) - (sub.end - sub.start)
+	}
+	text = append(text, s.Buf.Slice(prev, end)...)
+	s.Replace(start, end, text)
+	return lastStart
+}
+
+// splitSubstitute splits the argument of :s into its parts. The first
+// character is the delimiter; it can appear in the pattern and replacement
+// escaped with a backslash.
+func splitSubstitute(arg string) (pattern, repl, flags string, err error) {
+	if arg == "" {
+		return "", "", "", fmt.Errorf("usage: s/pattern/replacement/flags")
+	}
+	delim, rest := arg[0], arg[1:]
+	if delim == '\\' || delim == ' ' || ('a' <= delim && delim <= 'z') || ('A' <= delim && delim <= 'Z') || ('0' <= delim && delim <= '9') {
+		return "", "", "", fmt.Errorf("invalid delimiter %q", delim)
+	}
+
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(rest); i++ {
+		switch {
+		case rest[i] == '\\' && i+1 < len(rest) && rest[i+1] == delim:
+			b.WriteByte(delim)
+			i++
+		case rest[i] == delim && len(parts) < 2:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(rest[i])
+		}
+	}
+	parts = append(parts, b.String())
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// substitutions returns the replacements of matches of re in the lines first
+// to last, in order. Only the first match in each line is replaced unless
+// global is true.
+func (s *Session) substitutions(re *regexp.Regexp, repl []byte, first, last int, global bool) []substitution {
+	n := 1
+	if global {
+		n = -1
+	}
+	var subs []substitution
+	for l := first; l <= last; l++ {
+		start, end := s.lineRange(l, l)
+		line := bytes.TrimSuffix(s.Buf.Slice(start, end), []byte("\n"))
+		for _, m := range re.FindAllSubmatchIndex(line, n) {
+			text := re.Expand(nil, repl, line, m)
+			subs = append(subs, substitution{start + m[0], start + m[1], text})
+		}
+	}
+	return subs
+}
+
+// ModeConfirm steps through the substitutions of :s with the c flag, asking
+// for each one whether to make it.
+type ModeConfirm struct {
+	subs  []substitution
+	delta int // change in buffer size from the substitutions made so far
+	n     int // number of substitutions made
+}
+
+func (m *ModeConfirm) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	switch {
+	case ev.Ch == 'y':
+		m.apply(s)
+	case ev.Ch == 'n':
+		m.subs = m.subs[1:]
+	case ev.Ch == 'a':
+		for len(m.subs) > 0 {
+			m.apply(s)
+		}
+	case ev.Ch == 'q' || ev.Key == termbox.KeyEsc:
+		m.subs = nil
+	default:
+		return m, nil
+	}
+	if !m.next(s) {
+		s.EndGroup()
+		s.Info("%d substitutions", m.n)
+		return s.baseMode(), nil
+	}
+	return m, nil
+}
+
+// apply makes the first remaining substitution.
+func (m *ModeConfirm) apply(s *Session) {
+	sub := m.subs[0]
+	s.Replace(sub.start+m.delta, sub.end+m.delta, sub.text)
+	s.SetCursor(s.Buf.Pos(sub.start + m.delta))
+	m.delta += len(sub.text) - (sub.end - sub.start)
+	m.subs = m.subs[1:]
+	m.n++
+}
+
+// next moves the cursor to the next substitution and reports whether there
+// is one.
+func (m *ModeConfirm) next(s *Session) bool {
+	if len(m.subs) == 0 {
+		return false
+	}
+	s.SetCursor(s.Buf.Pos(m.subs[0].start + m.delta))
+	return true
+}
+
+func (m *ModeConfirm) draw(s *Session) {
+	if len(m.subs) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("replace with %q (y/n/a/q)?", m.subs[0].text)
+	for i, ch := range []rune(msg) {
+		termbox.SetCell(i, s.H, ch, 0, 0)
+	}
+}
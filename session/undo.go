@@ -0,0 +1,125 @@
+package session
+
+// change records a single buffer edit along with the cursor position before
+// and after it was made.
+type change struct {
+	id               int // unique within a History
+	offset           int
+	removed          []byte
+	inserted         []byte
+	beforeL, beforeC int
+	afterL, afterC   int
+}
+
+// group is a sequence of changes that are undone and redone together.
+type group []*change
+
+// History holds the undo and redo stacks of a session.
+type History struct {
+	undo   []group
+	redo   []group
+	depth  int  // nesting depth of open groups
+	open   bool // true if new changes extend the top undo group
+	lastid int
+}
+
+// state identifies the current state of the buffer: it is the id of the last
+// change applied, or 0 if all changes have been undone.
+func (h *History) state() int {
+	if len(h.undo) == 0 {
+		return 0
+	}
+	g := h.undo[len(h.undo)-1]
+	return g[len(g)-1].id
+}
+
+func (h *History) record(c *change) {
+	h.lastid++
+	c.id = h.lastid
+	h.redo = nil
+	if h.depth > 0 && h.open {
+		top := len(h.undo) - 1
+		h.undo[top] = append(h.undo[top], c)
+		return
+	}
+	h.undo = append(h.undo, group{c})
+	h.open = h.depth > 0
+}
+
+func (h *History) begin() {
+	if h.depth == 0 {
+		h.open = false
+	}
+	h.depth++
+}
+
+func (h *History) end() {
+	if h.depth > 0 {
+		h.depth--
+	}
+	if h.depth == 0 {
+		h.open = false
+	}
+}
+
+func (h *History) popUndo() group {
+	h.depth, h.open = 0, false
+	if len(h.undo) == 0 {
+		return nil
+	}
+	g := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, g)
+	return g
+}
+
+func (h *History) popRedo() group {
+	h.depth, h.open = 0, false
+	if len(h.redo) == 0 {
+		return nil
+	}
+	g := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, g)
+	return g
+}
+
+// StartGroup causes all following changes up to the matching EndGroup call to
+// be undone as a single step. Groups may be nested.
+func (s *Session) StartGroup() { s.hist.begin() }
+
+// EndGroup closes the group opened by the last call to StartGroup.
+func (s *Session) EndGroup() { s.hist.end() }
+
+// Undo reverts the most recent group of changes and restores the cursor to
+// where it was before they were made. It returns false if there was nothing
+// to undo.
+func (s *Session) Undo() bool {
+	g := s.hist.popUndo()
+	if g == nil {
+		return false
+	}
+	for i := len(g) - 1; i >= 0; i-- {
+		c := g[i]
+		s.Buf.Replace(c.offset, c.offset+len(c.inserted), c.removed)
+	}
+	s.SetCursor(g[0].beforeL, g[0].beforeC)
+	s.UpdSearch()
+	return true
+}
+
+// Redo reapplies the most recently undone group of changes. It returns false
+// if there was nothing to redo.
+func (s *Session) Redo() bool {
+	g := s.hist.popRedo()
+	if g == nil {
+		return false
+	}
+	for _, c := range g {
+		s.Buf.Replace(c.offset, c.offset+len(c.removed), c.inserted)
+	}
+	last := g[len(g)-1]
+	s.SetCursor(last.afterL, last.afterC)
+	s.UpdSearch()
+	return true
+}
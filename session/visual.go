@@ -0,0 +1,294 @@
+package session
+
+import (
+	"bytes"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/rwcarlsen/editor/util"
+	"github.com/rwcarlsen/editor/view"
+)
+
+type VisualKind int
+
+const (
+	VisualChar  VisualKind = iota // v: characters between anchor and cursor
+	VisualLine                    // V: whole lines between anchor and cursor
+	VisualBlock                   // Ctrl-V: rectangle with anchor and cursor at its corners
+)
+
+// selector is implemented by modes that select text. selection returns a
+// function reporting whether the character at line, char is selected.
+type selector interface {
+	selection(s *Session) func(line, char int) bool
+}
+
+// ModeVisual selects text between an anchor and the cursor. Motions move the
+// cursor and operators act on the selection. Keys are bound by the "visual"
+// keymap.
+type ModeVisual struct {
+	Kind   VisualKind
+	anchor int      // byte offset of the end of the selection opposite the cursor
+	keys   []string // pending keys of a multi-key motion
+	count  int
+	// withChar is the motion waiting for a character, if any. count is
+	// kept for it meanwhile.
+	withChar func(s *Session, ch rune) motion
+}
+
+// NewModeVisual returns a visual mode of the given kind with the selection
+// anchored at the cursor.
+func NewModeVisual(s *Session, kind VisualKind) *ModeVisual {
+	return &ModeVisual{Kind: kind, anchor: s.Buf.Offset(s.CursorL, s.CursorC)}
+}
+
+// visualCommand is a visual mode action other than a motion or operator. It
+// returns the mode to switch to.
+type visualCommand func(m *ModeVisual, s *Session) Mode
+
+var visualCommands = map[string]visualCommand{
+	"visual":       func(m *ModeVisual, s *Session) Mode { return m.toggle(VisualChar) },
+	"visual-line":  func(m *ModeVisual, s *Session) Mode { return m.toggle(VisualLine) },
+	"visual-block": func(m *ModeVisual, s *Session) Mode { return m.toggle(VisualBlock) },
+	"swap-anchor": func(m *ModeVisual, s *Session) Mode {
+		offset := s.Buf.Offset(s.CursorL, s.CursorC)
+		s.SetCursor(s.Buf.Pos(m.anchor))
+		m.anchor = offset
+		return m
+	},
+}
+
+func (m *ModeVisual) HandleKey(s *Session, ev termbox.Event) (Mode, error) {
+	if ev.Key == termbox.KeyEsc && ev.Ch == 0 {
+		return &ModeEdit{}, nil
+	} else if m.withChar != nil {
+		with, n := m.withChar, m.count
+		m.withChar, m.count = nil, 0
+		if ch := typedChar(ev); ch != 0 {
+			m.move(s, with(s, ch), n)
+		}
+		return m, nil
+	}
+
+	ch := ev.Ch
+	if len(m.keys) == 0 && ch >= '0' && ch <= '9' && (ch != '0' || m.count > 0) {
+		m.count = util.Min(m.count*10+int(ch-'0'), maxCount)
+		return m, nil
+	}
+
+	m.keys = append(m.keys, keyName(ev))
+	action, prefix := s.lookup(m.keys, "object", "visual")
+	if action == "" {
+		if !prefix {
+			m.keys, m.count = nil, 0
+		}
+		return m, nil
+	}
+	n := m.count
+	m.keys, m.count = nil, 0
+
+	if cmd, ok := visualCommands[action]; ok {
+		return cmd(m, s), nil
+	} else if _, ok := operators[action]; ok {
+		return orMode(m.apply(s, action), &ModeEdit{}), nil
+	} else if obj, ok := objects[action]; ok {
+		m.selectObject(s, obj)
+	} else if mo, ok := motions[action]; ok {
+		if mo.withChar != nil {
+			m.withChar, m.count = mo.withChar, n
+			return m, nil
+		} else if mo.resolve != nil {
+			mo = mo.resolve(s)
+		}
+		m.move(s, mo, n)
+	}
+	return m, nil
+}
+
+// selectObject selects the text object around the cursor, switching to
+// linewise selection for linewise objects.
+func (m *ModeVisual) selectObject(s *Session, obj object) {
+	offset := s.Buf.Offset(s.CursorL, s.CursorC)
+	start, end, ok := obj.fn(s.Buf, offset, obj.inner)
+	if !ok || end == start {
+		return
+	}
+	_, size := s.Buf.RuneBefore(end)
+	m.anchor = start
+	s.SetCursor(s.Buf.Pos(end - size))
+	if obj.linewise && m.Kind == VisualChar {
+		m.Kind = VisualLine
+	}
+}
+
+// move moves the cursor, and so the end of the selection, with mo.
+func (m *ModeVisual) move(s *Session, mo motion, n int) {
+	offset := s.Buf.Offset(s.CursorL, s.CursorC)
+	s.SetCursor(s.Buf.Pos(mo.fn(s, offset, n)))
+}
+
+// toggle switches to a visual mode of the given kind, or back to edit mode
+// if m already is of that kind.
+func (m *ModeVisual) toggle(kind VisualKind) Mode {
+	if m.Kind == kind {
+		return &ModeEdit{}
+	}
+	m.Kind = kind
+	return m
+}
+
+// span returns the byte range of a character or line selection.
+func (m *ModeVisual) span(s *Session) (start, end int) {
+	offset := s.Buf.Offset(s.CursorL, s.CursorC)
+	start, end = util.Min(m.anchor, offset), util.Max(m.anchor, offset)
+	if m.Kind == VisualLine {
+		return s.span(start, end, motion{linewise: true})
+	}
+	_, size := s.Buf.RuneAt(end)
+	return start, end + size
+}
+
+// blockSpans returns the byte range selected on each line of a block
+// selection, starting with the last line.
+func (m *ModeVisual) blockSpans(s *Session) [][2]int {
+	al, ac := s.Buf.Pos(m.anchor)
+	first, last := util.Min(al, s.CursorL), util.Max(al, s.CursorL)
+	left, right := m.columns(s, al, ac)
+
+	var spans [][2]int
+	for l := last; l >= first; l-- {
+		line := s.Buf.Line(l)
+		t := view.NewTabber(line, s.Tabwidth)
+		start, end := -1, -1
+		for ch := range line[:len(line)-1] {
+			if x0, x1 := charCols(t, ch); x1 >= left && x0 <= right {
+				if start == -1 {
+					start = ch
+				}
+				end = ch + 1
+			}
+		}
+		if start != -1 {
+			spans = append(spans, [2]int{s.Buf.Offset(l, start), s.Buf.Offset(l, end)})
+		}
+	}
+	return spans
+}
+
+// columns returns the leftmost and rightmost screen columns of a block
+// selection with its anchor at line al, char ac.
+func (m *ModeVisual) columns(s *Session, al, ac int) (left, right int) {
+	ta := view.NewTabber(s.Buf.Line(al), s.Tabwidth)
+	tc := view.NewTabber(s.Buf.Line(s.CursorL), s.Tabwidth)
+	a0, a1 := charCols(ta, ac)
+	c0, c1 := charCols(tc, s.CursorC)
+	return util.Min(a0, c0), util.Max(a1, c1)
+}
+
+// charCols returns the first and last screen columns occupied by the
+// character at index ch after tab expansion.
+func charCols(t *view.Tabber, ch int) (first, last int) {
+	if ch >= len(t.ChToX) {
+		return t.VisLen, t.VisLen
+	} else if ch > 0 {
+		first = t.ChToX[ch-1] + 1
+	}
+	return first, t.ChToX[ch]
+}
+
+func (m *ModeVisual) selection(s *Session) func(line, char int) bool {
+	switch m.Kind {
+	case VisualLine:
+		al, _ := s.Buf.Pos(m.anchor)
+		first, last := util.Min(al, s.CursorL), util.Max(al, s.CursorL)
+		return func(line, char int) bool { return line >= first && line <= last }
+	case VisualBlock:
+		al, ac := s.Buf.Pos(m.anchor)
+		first, last := util.Min(al, s.CursorL), util.Max(al, s.CursorL)
+		left, right := m.columns(s, al, ac)
+		tabbers := map[int]*view.Tabber{}
+		return func(line, char int) bool {
+			if line < first || line > last {
+				return false
+			}
+			t := tabbers[line]
+			if t == nil {
+				t = view.NewTabber(s.Buf.Line(line), s.Tabwidth)
+				tabbers[line] = t
+			}
+			x0, x1 := charCols(t, char)
+			return char < len(t.Line)-1 && x1 >= left && x0 <= right
+		}
+	default:
+		start, end := m.span(s)
+		return func(line, char int) bool {
+			offset := s.Buf.Offset(line, char)
+			return offset >= start && offset < end
+		}
+	}
+}
+
+// apply runs the operator op on the selection and returns the mode to switch
+// to, or nil for edit mode.
+func (m *ModeVisual) apply(s *Session, op string) Mode {
+	if m.Kind != VisualBlock {
+		start, end := m.span(s)
+		return operators[op](s, start, end, m.Kind == VisualLine)
+	}
+
+	if op == "indent" || op == "dedent" {
+		al, _ := s.Buf.Pos(m.anchor)
+		first, last := util.Min(al, s.CursorL), util.Max(al, s.CursorL)
+		return operators[op](s, s.Buf.Offset(first, 0), s.Buf.Offset(last+1, 0), true)
+	}
+
+	spans := m.blockSpans(s)
+	if len(spans) == 0 {
+		return nil
+	}
+	var text []byte
+	for i := len(spans) - 1; i >= 0; i-- {
+		text = append(text, s.Buf.Slice(spans[i][0], spans[i][1])...)
+		if i > 0 {
+			text = append(text, '\n')
+		}
+	}
+	top := spans[len(spans)-1]
+	bl, _ := s.Buf.Pos(spans[0][0])
+
+	switch op {
+	case "yank":
+		s.Yank(text, false)
+		s.SetCursor(s.Buf.Pos(top[0]))
+	case "delete", "change":
+		s.Yank(text, false)
+		s.StartGroup()
+		for _, sp := range spans {
+			s.Replace(sp[0], sp[1], nil)
+		}
+		s.SetCursor(s.Buf.Pos(top[0]))
+		if op == "delete" {
+			s.EndGroup()
+			return nil
+		}
+
+		// text typed on the first line is repeated on the others when
+		// leaving insert mode.
+		tl, tc := s.Buf.Pos(top[0])
+		x, _ := charCols(view.NewTabber(s.Buf.Line(tl), s.Tabwidth), tc)
+		return &ModeInsert{start: top[0], done: func(s *Session, typed []byte) {
+			if bytes.IndexByte(typed, '\n') != -1 {
+				return
+			}
+			for l := bl; l > tl; l-- {
+				t := view.NewTabber(s.Buf.Line(l), s.Tabwidth)
+				if x >= t.VisLen {
+					continue
+				}
+				offset := s.Buf.Offset(l, t.XToCh[x])
+				s.Replace(offset, offset, typed)
+			}
+			s.SetCursor(s.Buf.Pos(top[0] + len(typed)))
+		}}
+	}
+	return nil
+}
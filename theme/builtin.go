@@ -0,0 +1,60 @@
+package theme
+
+// Default is the theme used when none is chosen.
+var Default = Dark
+
+var (
+	Dark  = mustParse("dark", darkTheme)
+	Light = mustParse("light", lightTheme)
+)
+
+var builtin = map[string]*Theme{
+	"dark":  Dark,
+	"light": Light,
+}
+
+func mustParse(name, data string) *Theme {
+	t, err := Parse(name, []byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+const darkTheme = `{
+	"colors": 256,
+	"classes": {
+		"keyword":    {"fg": 221, "attrs": ["bold"]},
+		"builtin":    {"fg": 114},
+		"string":     {"fg": 173},
+		"number":     {"fg": 176},
+		"comment":    {"fg": 244},
+		"gutter":     {"fg": 242},
+		"status":     {"fg": 252, "bg": 237},
+		"warning":    {"fg": 221},
+		"error":      {"fg": 203, "attrs": ["bold"]},
+		"search":     {"fg": 16, "bg": 179},
+		"match":      {"fg": 16, "bg": 208},
+		"selection":  {"bg": 24},
+		"cursorline": {"bg": 235}
+	}
+}`
+
+const lightTheme = `{
+	"colors": 256,
+	"classes": {
+		"keyword":    {"fg": 25, "attrs": ["bold"]},
+		"builtin":    {"fg": 28},
+		"string":     {"fg": 124},
+		"number":     {"fg": 91},
+		"comment":    {"fg": 245},
+		"gutter":     {"fg": 248},
+		"status":     {"fg": 235, "bg": 252},
+		"warning":    {"fg": 130},
+		"error":      {"fg": 160, "attrs": ["bold"]},
+		"search":     {"bg": 229},
+		"match":      {"bg": 214},
+		"selection":  {"bg": 153},
+		"cursorline": {"bg": 255}
+	}
+}`
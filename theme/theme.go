@@ -0,0 +1,212 @@
+// Package theme maps the classes of things the editor draws, such as
+// keywords, the line number gutter and the selection, to terminal colours.
+//
+// Themes are stored as JSON:
+//
+//	{
+//		"colors": 256,
+//		"classes": {
+//			"keyword": {"fg": "yellow", "attrs": ["bold"]},
+//			"comment": {"fg": 244},
+//			"selection": {"bg": "blue"}
+//		}
+//	}
+//
+// Colours are either one of the names default, black, red, green, yellow,
+// blue, magenta, cyan, white (optionally prefixed with "light", or darkgray)
+// or, in themes with "colors": 256, a number from 0 to 255 indexing the
+// terminal's 256 colour palette. Attrs may contain bold, underline, reverse,
+// dim and cursive.
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Classes lists the classes a theme may give colours to.
+var Classes = []string{
+	"plain", "keyword", "builtin", "string", "number", "comment", "operator",
+	"gutter", "status", "warning", "error", "search", "match", "selection",
+	"cursorline",
+}
+
+// Style is the attributes text of a class is drawn with.
+type Style struct {
+	Fg, Bg termbox.Attribute
+}
+
+// Theme is a named set of styles.
+type Theme struct {
+	Name string
+	// Colors is 256 if the theme uses the 256 colour palette and 8
+	// otherwise.
+	Colors int
+	Styles map[string]Style
+}
+
+// Attr returns the attributes of class. Classes the theme does not mention
+// are drawn in the terminal's default colours.
+func (t *Theme) Attr(class string) (fg, bg termbox.Attribute) {
+	st := t.Styles[class]
+	return st.Fg, st.Bg
+}
+
+// OutputMode returns the termbox output mode the theme needs.
+func (t *Theme) OutputMode() termbox.OutputMode {
+	if t.Colors == 256 {
+		return termbox.Output256
+	}
+	return termbox.OutputNormal
+}
+
+type jsonTheme struct {
+	Colors  int
+	Classes map[string]jsonStyle
+}
+
+type jsonStyle struct {
+	Fg    interface{}
+	Bg    interface{}
+	Attrs []string
+}
+
+var colorNames = map[string]termbox.Attribute{
+	"default":      termbox.ColorDefault,
+	"black":        termbox.ColorBlack,
+	"red":          termbox.ColorRed,
+	"green":        termbox.ColorGreen,
+	"yellow":       termbox.ColorYellow,
+	"blue":         termbox.ColorBlue,
+	"magenta":      termbox.ColorMagenta,
+	"cyan":         termbox.ColorCyan,
+	"white":        termbox.ColorWhite,
+	"darkgray":     termbox.ColorDarkGray,
+	"lightred":     termbox.ColorLightRed,
+	"lightgreen":   termbox.ColorLightGreen,
+	"lightyellow":  termbox.ColorLightYellow,
+	"lightblue":    termbox.ColorLightBlue,
+	"lightmagenta": termbox.ColorLightMagenta,
+	"lightcyan":    termbox.ColorLightCyan,
+	"lightgray":    termbox.ColorLightGray,
+}
+
+var attrNames = map[string]termbox.Attribute{
+	"bold":      termbox.AttrBold,
+	"underline": termbox.AttrUnderline,
+	"reverse":   termbox.AttrReverse,
+	"dim":       termbox.AttrDim,
+	"cursive":   termbox.AttrCursive,
+}
+
+// Parse parses a theme in JSON format.
+func Parse(name string, data []byte) (*Theme, error) {
+	var jt jsonTheme
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return nil, fmt.Errorf("theme %v: %v", name, err)
+	}
+	if jt.Colors == 0 {
+		jt.Colors = 8
+	} else if jt.Colors != 8 && jt.Colors != 256 {
+		return nil, fmt.Errorf("theme %v: colors must be 8 or 256", name)
+	}
+
+	t := &Theme{Name: name, Colors: jt.Colors, Styles: map[string]Style{}}
+	for class, js := range jt.Classes {
+		fg, err := t.color(js.Fg)
+		if err != nil {
+			return nil, fmt.Errorf("theme %v: %v: %v", name, class, err)
+		}
+		bg, err := t.color(js.Bg)
+		if err != nil {
+			return nil, fmt.Errorf("theme %v: %v: %v", name, class, err)
+		}
+		for _, a := range js.Attrs {
+			attr, ok := attrNames[a]
+			if !ok {
+				return nil, fmt.Errorf("theme %v: %v: unknown attribute %q", name, class, a)
+			}
+			fg |= attr
+		}
+		t.Styles[class] = Style{fg, bg}
+	}
+	return t, nil
+}
+
+// color converts a colour name or palette number to an attribute.
+func (t *Theme) color(v interface{}) (termbox.Attribute, error) {
+	switch v := v.(type) {
+	case nil:
+		return termbox.ColorDefault, nil
+	case string:
+		if c, ok := colorNames[strings.ToLower(v)]; ok {
+			return c, nil
+		}
+		if n, err := strconv.Atoi(v); err == nil {
+			return t.color(float64(n))
+		}
+		return 0, fmt.Errorf("unknown colour %q", v)
+	case float64:
+		if t.Colors != 256 {
+			return 0, fmt.Errorf("colour %v needs \"colors\": 256", v)
+		} else if v < 0 || v > 255 || v != float64(int(v)) {
+			return 0, fmt.Errorf("invalid colour %v", v)
+		}
+		return termbox.Attribute(v) + 1, nil
+	}
+	return 0, fmt.Errorf("invalid colour %v", v)
+}
+
+// Dir is the directory Load looks for themes in.
+func Dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "editor", "themes")
+}
+
+// Load returns the theme called name: a file name.json in Dir, one of the
+// built in themes, or, if name contains a path separator, the theme in the
+// file name.
+func Load(name string) (*Theme, error) {
+	path := name
+	if !strings.ContainsRune(name, filepath.Separator) {
+		if t, ok := builtin[name]; ok {
+			return t, nil
+		}
+		path = filepath.Join(Dir(), name+".json")
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && path != name {
+		return nil, fmt.Errorf("no theme %q", name)
+	} else if err != nil {
+		return nil, err
+	}
+	return Parse(strings.TrimSuffix(filepath.Base(name), ".json"), data)
+}
+
+// Names returns the names of the built in themes and those in Dir.
+func Names() []string {
+	var names []string
+	for name := range builtin {
+		names = append(names, name)
+	}
+	paths, _ := filepath.Glob(filepath.Join(Dir(), "*.json"))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if _, ok := builtin[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,81 @@
+package theme
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+type parsetest struct {
+	json   string
+	colors int
+	styles map[string]Style
+}
+
+var parsetests = []parsetest{
+	{`{}`, 8, map[string]Style{}},
+	{
+		`{"classes": {"keyword": {"fg": "yellow", "attrs": ["bold"]}, "selection": {"bg": "Blue"}}}`,
+		8,
+		map[string]Style{
+			"keyword":   {termbox.ColorYellow | termbox.AttrBold, termbox.ColorDefault},
+			"selection": {termbox.ColorDefault, termbox.ColorBlue},
+		},
+	},
+	{
+		`{"colors": 256, "classes": {"comment": {"fg": 244, "bg": "17"}, "plain": {"fg": "lightgray"}}}`,
+		256,
+		map[string]Style{
+			"comment": {245, 18},
+			"plain":   {termbox.ColorLightGray, termbox.ColorDefault},
+		},
+	},
+}
+
+func TestParse(t *testing.T) {
+	for i, test := range parsetests {
+		th, err := Parse("test", []byte(test.json))
+		if err != nil {
+			t.Errorf("test %v: %v", i, err)
+			continue
+		}
+		if th.Colors != test.colors {
+			t.Errorf("test %v: expected %v colors, got %v", i, test.colors, th.Colors)
+		}
+		if !reflect.DeepEqual(th.Styles, test.styles) {
+			t.Errorf("test %v: expected %v, got %v", i, test.styles, th.Styles)
+		}
+	}
+}
+
+// errtests maps invalid themes to part of the error they give.
+var errtests = map[string]string{
+	`{"classes": {"keyword": {"fg": "mauve"}}}`:          `unknown colour "mauve"`,
+	`{"classes": {"keyword": {"fg": 100}}}`:              `needs "colors": 256`,
+	`{"colors": 256, "classes": {"plain": {"bg": 256}}}`: "invalid colour 256",
+	`{"colors": 256, "classes": {"plain": {"bg": 1.5}}}`: "invalid colour 1.5",
+	`{"classes": {"plain": {"fg": true}}}`:               "invalid colour true",
+	`{"classes": {"plain": {"attrs": ["blink"]}}}`:       `unknown attribute "blink"`,
+	`{"colors": 16}`:  "colors must be 8 or 256",
+	`{"classes": {`:   "unexpected end of JSON input",
+	`{"classes": []}`: "cannot unmarshal",
+}
+
+func TestParseErrors(t *testing.T) {
+	for json, expect := range errtests {
+		_, err := Parse("test", []byte(json))
+		if err == nil || !strings.Contains(err.Error(), expect) || !strings.HasPrefix(err.Error(), "theme test: ") {
+			t.Errorf("%v: expected an error containing %q, got %v", json, expect, err)
+		}
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	for name := range builtin {
+		if th, err := Load(name); err != nil || th.Name != name {
+			t.Errorf("Load(%q): got %v, %v", name, th, err)
+		}
+	}
+}
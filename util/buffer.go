@@ -7,54 +7,109 @@ import (
 	termbox "github.com/nsf/termbox-go"
 )
 
+// Buffer holds text in a rope so that edits take time proportional to the
+// size of the edit and the log of the size of the buffer rather than the size
+// of the buffer itself.
 type Buffer struct {
-	data  []byte
-	fgs   []termbox.Attribute
-	bgs   []termbox.Attribute
-	lines [][]rune
+	root   *node
+	styler Styler
+	data   []byte        // cached content; nil if stale
+	lines  map[int]*line // cached decoded lines; cleared on every edit
+}
+
+// Styler supplies the display attributes of the characters in a buffer.
+type Styler interface {
+	Style(line, char int) (fg, bg termbox.Attribute)
+	// Invalidate is called after an edit that changed the given line and
+	// possibly the lines after it.
+	Invalidate(line int)
+}
+
+type line struct {
+	raw   []byte
+	runes []rune
 }
 
 func NewBuffer(data []byte) *Buffer {
-	b := &Buffer{data: data}
-	b.updLines()
-	return b
+	return &Buffer{root: build(data)}
 }
 
 func (b *Buffer) Rune(line, char int) rune {
-	return b.lines[line][char]
+	return b.line(line).runes[char]
 }
 
 func (b *Buffer) Line(n int) []rune {
-	return b.lines[n]
-}
-
-func (b *Buffer) updLines() {
-	slines := bytes.SplitAfter(b.data, []byte("\n"))
-	b.lines = make([][]rune, len(slines))
-	for i, l := range slines {
-		b.lines[i] = bytes.Runes(l)
-	}
-	if len(b.lines) > 0 {
-		i := len(b.lines) - 1
-		l := b.lines[i]
-		if len(l) > 0 && l[len(l)-1] != '\n' {
-			b.lines[i] = append(l, '\n')
-		} else if len(b.lines[i]) == 0 {
-			b.lines = b.lines[:i]
-		}
+	return b.line(n).runes
+}
+
+func (b *Buffer) line(n int) *line {
+	if l, ok := b.lines[n]; ok {
+		return l
+	}
+	if n < 0 || n >= b.Nlines() {
+		panic("util: line index out of range")
+	}
+
+	start, end := b.lineStart(n), b.Len()
+	if n < newlinesIn(b.root) {
+		end = newlineOffset(b.root, n+1)
+	}
+	l := &line{raw: appendTo(nil, b.root, start, end)}
+	l.runes = bytes.Runes(l.raw)
+	if len(l.runes) == 0 || l.runes[len(l.runes)-1] != '\n' {
+		l.runes = append(l.runes, '\n')
+	}
+
+	if b.lines == nil {
+		b.lines = map[int]*line{}
+	}
+	b.lines[n] = l
+	return l
+}
+
+// SetStyler makes st supply the attributes returned by Attr.
+func (b *Buffer) SetStyler(st Styler) {
+	b.styler = st
+}
+
+// Attr returns the foreground and background attributes the character at
+// line, char is drawn with.
+func (b *Buffer) Attr(line, char int) (fg, bg termbox.Attribute) {
+	if b.styler == nil {
+		return 0, 0
 	}
+	return b.styler.Style(line, char)
+}
+
+// lineStart returns the byte offset of the first character of line n.
+func (b *Buffer) lineStart(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return newlineOffset(b.root, n)
 }
 
 // Nlines returns the total number of lines (separated by '\n') in the buffer.
+// An empty buffer has a single empty line.
 func (b *Buffer) Nlines() int {
-	return len(b.lines)
+	n := newlinesIn(b.root)
+	if size := b.Len(); size == 0 || b.byteAt(size-1) != '\n' {
+		n++
+	}
+	return n
+}
+
+// Len returns the number of bytes in the buffer.
+func (b *Buffer) Len() int { return bytesIn(b.root) }
+
+func (b *Buffer) byteAt(offset int) byte {
+	return appendTo(make([]byte, 0, 1), b.root, offset, offset+1)[0]
 }
 
 // Insert adds passed runes into the buffer at the given byte offset. Returns the number of bytes inserted
 func (b *Buffer) Insert(offset int, rs ...rune) (n int) {
 	bs := []byte(string(rs))
-	b.data = append(b.data[:offset], append(bs, b.data[offset:]...)...)
-	b.updLines()
+	b.Replace(offset, offset, bs)
 	return len(bs)
 }
 
@@ -62,44 +117,81 @@ func (b *Buffer) Insert(offset int, rs ...rune) (n int) {
 // nrunes is negative, offset is the exclusive upper bound of the removed
 // characters. It returns the number of bytes removed.
 func (b *Buffer) Delete(offset, nrunes int) (n int) {
-	if nrunes == 0 {
-		return 0
+	start, end := b.Span(offset, nrunes)
+	b.Replace(start, end, nil)
+	return end - start
+}
+
+// Replace substitutes text for the bytes in the range [start, end).
+func (b *Buffer) Replace(start, end int, text []byte) {
+	if b.styler != nil {
+		defer b.styler.Invalidate(countNewlines(b.root, start))
 	}
+	l, rest := split(b.root, start)
+	_, r := split(rest, end-start)
+	if len(text) > 0 && !appendText(l, text) {
+		l = merge(l, build(text))
+	}
+	b.root = merge(l, r)
+	b.data = nil
+	b.lines = nil
+}
 
-	nb := 0
+// Span returns the byte range covering nrunes characters starting at the
+// given byte offset. If nrunes is negative, offset is the exclusive upper
+// bound of the range.
+func (b *Buffer) Span(offset, nrunes int) (start, end int) {
+	start, end = offset, offset
 	if nrunes > 0 {
-		for n := 0; n < nrunes; n++ {
-			_, size := utf8.DecodeRune(b.data[offset+nb:])
-			nb += size
+		chunk := b.Slice(offset, Min(offset+nrunes*utf8.UTFMax, b.Len()))
+		for n := 0; n < nrunes && len(chunk) > 0; n++ {
+			_, size := utf8.DecodeRune(chunk)
+			chunk = chunk[size:]
+			end += size
 		}
-		b.data = append(b.data[:offset], b.data[offset+nb:]...)
-	} else {
-		for n := 0; n > nrunes; n-- {
-			_, size := utf8.DecodeLastRune(b.data[:offset-nb])
-			nb += size
+	} else if nrunes < 0 {
+		chunk := b.Slice(Max(offset+nrunes*utf8.UTFMax, 0), offset)
+		for n := 0; n > nrunes && len(chunk) > 0; n-- {
+			_, size := utf8.DecodeLastRune(chunk)
+			chunk = chunk[:len(chunk)-size]
+			start -= size
 		}
-		b.data = append(b.data[:offset-nb], b.data[offset:]...)
 	}
-	b.updLines()
-	return nb
+	return start, end
+}
+
+// Slice returns a copy of the bytes in the range [start, end).
+func (b *Buffer) Slice(start, end int) []byte {
+	return appendTo(make([]byte, 0, end-start), b.root, start, end)
 }
 
 // Pos returns the line and character index of the given byte offset.
 func (b *Buffer) Pos(offset int) (line, char int) {
-	lines := bytes.SplitAfter(b.data[:offset], []byte("\n"))
-	return len(lines) - 1, utf8.RuneCount(lines[len(lines)-1])
+	line = countNewlines(b.root, offset)
+	return line, utf8.RuneCount(b.Slice(b.lineStart(line), offset))
 }
 
 // Offset returns the byte offset of the given line and char index.
 func (b *Buffer) Offset(line, char int) int {
-	offset := 0
-	for _, line := range b.lines[:line] {
-		offset += len(line)
+	if line >= b.Nlines() {
+		return b.Len()
 	}
-	return offset + char
+	offset := b.lineStart(line)
+	raw := b.line(line).raw
+	for n := 0; n < char && len(raw) > 0; n++ {
+		_, size := utf8.DecodeRune(raw)
+		raw = raw[size:]
+		offset += size
+	}
+	return offset
 }
 
+// Bytes returns the content of the buffer. The returned slice must not be
+// modified and is only valid until the next edit.
 func (b *Buffer) Bytes() []byte {
+	if b.data == nil {
+		b.data = appendTo(make([]byte, 0, b.Len()), b.root, 0, b.Len())
+	}
 	return b.data
 }
 
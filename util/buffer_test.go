@@ -0,0 +1,182 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+)
+
+type edittest struct {
+	text   string
+	offset int
+	del    int
+	ins    string
+	expect string
+}
+
+var edittests = []edittest{
+	edittest{text: "", offset: 0, ins: "abc", expect: "abc"},
+	edittest{text: "abc", offset: 3, ins: "\ndef", expect: "abc\ndef"},
+	edittest{text: "abc\ndef\n", offset: 2, del: 3, expect: "abef\n"},
+	edittest{text: "abc\ndef\n", offset: 4, del: 4, ins: "x", expect: "abc\nx"},
+	edittest{text: "héllo\n", offset: 1, del: 2, ins: "e", expect: "hello\n"},
+}
+
+func TestReplace(t *testing.T) {
+	for i, tst := range edittests {
+		b := NewBuffer([]byte(tst.text))
+		b.Replace(tst.offset, tst.offset+tst.del, []byte(tst.ins))
+		if got := string(b.Bytes()); got != tst.expect {
+			t.Errorf("test %v: expected %q, got %q", i, tst.expect, got)
+		}
+	}
+}
+
+type postest struct {
+	text       string
+	offset     int
+	line, char int
+}
+
+var postests = []postest{
+	postest{text: "abc\ndef\n", offset: 0, line: 0, char: 0},
+	postest{text: "abc\ndef\n", offset: 3, line: 0, char: 3},
+	postest{text: "abc\ndef\n", offset: 4, line: 1, char: 0},
+	postest{text: "abc\ndef\n", offset: 6, line: 1, char: 2},
+	postest{text: "héllo\nwörld", offset: 11, line: 1, char: 3},
+}
+
+func TestPosOffset(t *testing.T) {
+	for i, tst := range postests {
+		b := NewBuffer([]byte(tst.text))
+		if l, c := b.Pos(tst.offset); l != tst.line || c != tst.char {
+			t.Errorf("test %v: Pos(%v): expected %v,%v, got %v,%v",
+				i, tst.offset, tst.line, tst.char, l, c)
+		}
+		if got := b.Offset(tst.line, tst.char); got != tst.offset {
+			t.Errorf("test %v: Offset(%v, %v): expected %v, got %v",
+				i, tst.line, tst.char, tst.offset, got)
+		}
+	}
+}
+
+// refLines splits data into lines the way Buffer.Line reports them. An
+// empty buffer has a single empty line.
+func refLines(data []byte) [][]rune {
+	slines := bytes.SplitAfter(data, []byte("\n"))
+	lines := make([][]rune, len(slines))
+	for i, l := range slines {
+		lines[i] = bytes.Runes(l)
+	}
+	i := len(lines) - 1
+	if l := lines[i]; (len(l) > 0 && l[len(l)-1] != '\n') || len(data) == 0 {
+		lines[i] = append(l, '\n')
+	} else if len(l) == 0 {
+		lines = lines[:i]
+	}
+	return lines
+}
+
+var nlinestests = map[string]int{
+	"":       1,
+	"\n":     1,
+	"a":      1,
+	"a\n":    1,
+	"a\nb":   2,
+	"a\n\n":  2,
+	"a\nb\n": 2,
+}
+
+func TestNlines(t *testing.T) {
+	for text, expect := range nlinestests {
+		b := NewBuffer([]byte(text))
+		if got := b.Nlines(); got != expect {
+			t.Errorf("Nlines(%q): expected %v, got %v", text, expect, got)
+		}
+		if got := len(refLines([]byte(text))); got != expect {
+			t.Errorf("refLines(%q): expected %v lines, got %v", text, expect, got)
+		}
+		if got := string(b.Line(expect - 1)); got[len(got)-1] != '\n' {
+			t.Errorf("Line(%v) of %q: expected a trailing newline, got %q", expect-1, text, got)
+		}
+	}
+}
+
+// TestRandomEdits checks the rope against a plain byte slice after many small
+// random edits.
+func TestRandomEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []rune("ab\nç\t")
+	var ref []byte
+	b := NewBuffer(nil)
+	for i := 0; i < 5000; i++ {
+		start := r.Intn(len(ref) + 1)
+		for start > 0 && start < len(ref) && !utf8.RuneStart(ref[start]) {
+			start--
+		}
+		_, end := b.Span(start, r.Intn(4))
+
+		var ins []rune
+		for n := r.Intn(4); n > 0; n-- {
+			ins = append(ins, alphabet[r.Intn(len(alphabet))])
+		}
+
+		b.Replace(start, end, []byte(string(ins)))
+		ref = append(ref[:start:start], append([]byte(string(ins)), ref[end:]...)...)
+
+		if !bytes.Equal(b.Bytes(), ref) {
+			t.Fatalf("edit %v: expected %q, got %q", i, ref, b.Bytes())
+		}
+	}
+
+	lines := refLines(ref)
+	if b.Nlines() != len(lines) {
+		t.Fatalf("expected %v lines, got %v", len(lines), b.Nlines())
+	}
+	offset := 0
+	for i, l := range lines {
+		if got := string(b.Line(i)); got != string(l) {
+			t.Errorf("line %v: expected %q, got %q", i, string(l), got)
+		}
+		if got := b.Offset(i, 0); got != offset {
+			t.Errorf("line %v: expected offset %v, got %v", i, offset, got)
+		}
+		if l, c := b.Pos(offset); l != i || c != 0 {
+			t.Errorf("Pos(%v): expected %v,0, got %v,%v", offset, i, l, c)
+		}
+		offset += len(string(l))
+	}
+}
+
+func benchText(size int) []byte {
+	line := []byte("the quick brown fox jumps over the lazy dog\n")
+	return bytes.Repeat(line, size/len(line)+1)[:size]
+}
+
+func benchEdit(b *testing.B, size int) {
+	buf := NewBuffer(benchText(size))
+	offset := size / 2
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Insert(offset, 'x', '\n')
+		buf.Delete(offset, 2)
+		buf.Line(buf.Nlines() / 2)
+	}
+}
+
+func BenchmarkEdit1K(b *testing.B)  { benchEdit(b, 1<<10) }
+func BenchmarkEdit1M(b *testing.B)  { benchEdit(b, 1<<20) }
+func BenchmarkEdit16M(b *testing.B) { benchEdit(b, 1<<24) }
+
+func BenchmarkPos(b *testing.B) {
+	for _, size := range []int{1 << 10, 1 << 20, 1 << 24} {
+		buf := NewBuffer(benchText(size))
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				buf.Pos(size / 2)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package util
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// RuneAt returns the rune starting at the given byte offset and its size in
+// bytes. At the end of the buffer it returns utf8.RuneError and a size of 0.
+func (b *Buffer) RuneAt(offset int) (r rune, size int) {
+	if offset >= b.Len() {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeRune(b.Slice(offset, Min(offset+utf8.UTFMax, b.Len())))
+}
+
+// RuneBefore returns the rune ending at the given byte offset and its size in
+// bytes. At the start of the buffer it returns utf8.RuneError and a size of 0.
+func (b *Buffer) RuneBefore(offset int) (r rune, size int) {
+	if offset <= 0 {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeLastRune(b.Slice(Max(offset-utf8.UTFMax, 0), offset))
+}
+
+const (
+	classSpace = iota
+	classPunct
+	classWord
+)
+
+// wordClass groups runes into the classes that delimit words: letters, digits,
+// marks and '_' make up words, other non-space runes are punctuation.
+func wordClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return classSpace
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+		return classWord
+	default:
+		return classPunct
+	}
+}
+
+// bigWordClass groups runes into the classes that delimit WORDs, which are
+// separated only by space.
+func bigWordClass(r rune) int {
+	if unicode.IsSpace(r) {
+		return classSpace
+	}
+	return classWord
+}
+
+// NextWord returns the offset of the start of the word following the one at
+// offset. Empty lines count as words.
+func NextWord(b *Buffer, offset int) int { return nextWord(b, offset, wordClass) }
+
+// NextBigWord is like NextWord for WORDs: runs of non-space characters.
+func NextBigWord(b *Buffer, offset int) int { return nextWord(b, offset, bigWordClass) }
+
+// PrevWord returns the offset of the start of the word at or before offset.
+// Empty lines count as words.
+func PrevWord(b *Buffer, offset int) int { return prevWord(b, offset, wordClass) }
+
+// PrevBigWord is like PrevWord for WORDs.
+func PrevBigWord(b *Buffer, offset int) int { return prevWord(b, offset, bigWordClass) }
+
+// WordEnd returns the offset of the last character of the word ending after
+// offset.
+func WordEnd(b *Buffer, offset int) int { return wordEnd(b, offset, wordClass) }
+
+// BigWordEnd is like WordEnd for WORDs.
+func BigWordEnd(b *Buffer, offset int) int { return wordEnd(b, offset, bigWordClass) }
+
+// emptyLine returns true if offset is at the start of an empty line.
+func emptyLine(b *Buffer, offset int) bool {
+	r, _ := b.RuneAt(offset)
+	prev, size := b.RuneBefore(offset)
+	return r == '\n' && (size == 0 || prev == '\n')
+}
+
+func nextWord(b *Buffer, offset int, class func(rune) int) int {
+	r, size := b.RuneAt(offset)
+	if size == 0 {
+		return offset
+	}
+	if c := class(r); c != classSpace {
+		for size > 0 && class(r) == c {
+			offset += size
+			r, size = b.RuneAt(offset)
+		}
+	}
+	for size > 0 && class(r) == classSpace {
+		offset += size
+		if emptyLine(b, offset) {
+			return offset
+		}
+		r, size = b.RuneAt(offset)
+	}
+	return offset
+}
+
+func prevWord(b *Buffer, offset int, class func(rune) int) int {
+	r, size := b.RuneBefore(offset)
+	for size > 0 && class(r) == classSpace {
+		offset -= size
+		if emptyLine(b, offset) {
+			return offset
+		}
+		r, size = b.RuneBefore(offset)
+	}
+	c := class(r)
+	for size > 0 && class(r) == c {
+		offset -= size
+		r, size = b.RuneBefore(offset)
+	}
+	return offset
+}
+
+func wordEnd(b *Buffer, offset int, class func(rune) int) int {
+	_, size := b.RuneAt(offset)
+	offset += size
+	r, size := b.RuneAt(offset)
+	for size > 0 && class(r) == classSpace {
+		offset += size
+		r, size = b.RuneAt(offset)
+	}
+	c := class(r)
+	for {
+		next, nsize := b.RuneAt(offset + size)
+		if nsize == 0 || class(next) != c {
+			return offset
+		}
+		offset += size
+		r, size = next, nsize
+	}
+}
+
+// LineStart returns the offset of the first character of the line containing
+// offset.
+func LineStart(b *Buffer, offset int) int {
+	line, _ := b.Pos(offset)
+	return b.Offset(line, 0)
+}
+
+// LineEnd returns the offset of the last character before the newline of the
+// line containing offset, or the line's start if it is empty.
+func LineEnd(b *Buffer, offset int) int {
+	line, _ := b.Pos(offset)
+	if line >= b.Nlines() {
+		return b.Len()
+	}
+	return b.Offset(line, Max(len(b.Line(line))-2, 0))
+}
+
+// FirstNonBlank returns the offset of the first character that is not a space
+// or tab on the line containing offset.
+func FirstNonBlank(b *Buffer, offset int) int {
+	offset = LineStart(b, offset)
+	for {
+		r, size := b.RuneAt(offset)
+		if size == 0 || (r != ' ' && r != '\t') {
+			return offset
+		}
+		offset += size
+	}
+}
+
+// NextParagraph returns the offset of the first empty line after the
+// paragraph at or after offset, or of the last character of the buffer if
+// there is none.
+func NextParagraph(b *Buffer, offset int) int {
+	line, _ := b.Pos(offset)
+	for line < b.Nlines() && len(b.Line(line)) <= 1 {
+		line++
+	}
+	for ; line < b.Nlines(); line++ {
+		if len(b.Line(line)) <= 1 {
+			return b.Offset(line, 0)
+		}
+	}
+	_, size := b.RuneBefore(b.Len())
+	return b.Len() - size
+}
+
+// PrevParagraph returns the offset of the first empty line before the
+// paragraph at or before offset, or 0 if there is none.
+func PrevParagraph(b *Buffer, offset int) int {
+	line, _ := b.Pos(offset)
+	for line > 0 && len(b.Line(line)) <= 1 {
+		line--
+	}
+	for ; line > 0; line-- {
+		if len(b.Line(line)) <= 1 {
+			return b.Offset(line, 0)
+		}
+	}
+	return 0
+}
+
+var brackets = map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+
+// MatchBracket returns the offset of the bracket matching the first of ()[]{}
+// at or after offset on its line. It returns offset and false if there is no
+// bracket or it is unmatched.
+func MatchBracket(b *Buffer, offset int) (int, bool) {
+	start := offset
+	r, size := b.RuneAt(offset)
+	for size > 0 && r != '\n' {
+		if _, ok := brackets[r]; ok {
+			break
+		}
+		offset += size
+		r, size = b.RuneAt(offset)
+	}
+	match, ok := brackets[r]
+	if size == 0 || !ok {
+		return start, false
+	}
+
+	open := r
+	forward := r == '(' || r == '[' || r == '{'
+	depth := 0
+	for size > 0 {
+		if r == open {
+			depth++
+		} else if r == match {
+			depth--
+		}
+		if depth == 0 {
+			return offset, true
+		}
+		if forward {
+			offset += size
+			r, size = b.RuneAt(offset)
+		} else {
+			r, size = b.RuneBefore(offset)
+			offset -= size
+		}
+	}
+	return start, false
+}
+
+// FindChar returns the offset of the next (or, if back is true, previous)
+// occurrence of ch on the line containing offset. If till is true, it
+// returns the offset of the character just before (or after) it instead. The
+// boolean is false if ch is not found.
+func FindChar(b *Buffer, offset int, ch rune, back, till bool) (int, bool) {
+	pos := offset
+	for {
+		var r rune
+		var size int
+		if back {
+			r, size = b.RuneBefore(pos)
+			pos -= size
+		} else if r, size = b.RuneAt(pos); size > 0 && r != '\n' {
+			pos += size
+			r, size = b.RuneAt(pos)
+		}
+		if size == 0 || r == '\n' {
+			return offset, false
+		}
+		if r != ch {
+			continue
+		}
+		if !till {
+			return pos, true
+		} else if back {
+			_, size = b.RuneAt(pos)
+			return pos + size, true
+		}
+		_, size = b.RuneBefore(pos)
+		return pos - size, true
+	}
+}
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+// motiontest holds a text with the motion's start marked by '|' and its
+// expected result by '^'. If both are at the same offset, only '^' is given.
+type motiontest struct {
+	name string
+	text string
+}
+
+var motions = map[string]func(b *Buffer, offset int) int{
+	"NextWord":      NextWord,
+	"NextBigWord":   NextBigWord,
+	"PrevWord":      PrevWord,
+	"PrevBigWord":   PrevBigWord,
+	"WordEnd":       WordEnd,
+	"BigWordEnd":    BigWordEnd,
+	"LineStart":     LineStart,
+	"LineEnd":       LineEnd,
+	"FirstNonBlank": FirstNonBlank,
+	"NextParagraph": NextParagraph,
+	"PrevParagraph": PrevParagraph,
+	"MatchBracket": func(b *Buffer, offset int) int {
+		offset, _ = MatchBracket(b, offset)
+		return offset
+	},
+	"f": func(b *Buffer, offset int) int {
+		offset, _ = FindChar(b, offset, 'x', false, false)
+		return offset
+	},
+	"t": func(b *Buffer, offset int) int {
+		offset, _ = FindChar(b, offset, 'x', false, true)
+		return offset
+	},
+	"F": func(b *Buffer, offset int) int {
+		offset, _ = FindChar(b, offset, 'x', true, false)
+		return offset
+	},
+	"T": func(b *Buffer, offset int) int {
+		offset, _ = FindChar(b, offset, 'x', true, true)
+		return offset
+	},
+}
+
+var motiontests = []motiontest{
+	{"NextWord", "|foo ^bar\n"},
+	{"NextWord", "|foo^.bar\n"},
+	{"NextWord", "f|oo ^bar\n"},
+	{"NextWord", "|foo\n  ^bar\n"},
+	{"NextWord", "|foo\n^\nbar\n"},
+	{"NextWord", "|héllo ^wörld\n"},
+	{"NextWord", "|日本語 ^テスト\n"},
+	{"NextWord", "|café ^x\n"},
+	{"NextWord", "foo |bar^"},
+	{"NextBigWord", "|foo.bar ^baz\n"},
+	{"NextBigWord", "|a-b\n^c\n"},
+	{"PrevWord", "^foo |bar\n"},
+	{"PrevWord", "foo.^bar|\n"},
+	{"PrevWord", "foo\n^\n|bar\n"},
+	{"PrevWord", "^héllo |wörld\n"},
+	{"PrevBigWord", "^foo.bar |baz\n"},
+	{"PrevBigWord", "foo ^a.b|c\n"},
+	{"WordEnd", "|fo^o bar\n"},
+	{"WordEnd", "fo|o ba^r\n"},
+	{"WordEnd", "|fo^o.bar\n"},
+	{"WordEnd", "|wör^d\n"},
+	{"BigWordEnd", "|foo.ba^r baz\n"},
+	{"LineStart", "abc\n^de|f\n"},
+	{"LineEnd", "a|b^c\ndef\n"},
+	{"LineEnd", "abc\n|^\n"},
+	{"FirstNonBlank", "  \t^fo|o\n"},
+	{"FirstNonBlank", "|  ^foo\n"},
+	{"NextParagraph", "|a\nb\n^\nc\n"},
+	{"NextParagraph", "a\n|\n\nb\n^\nc\n"},
+	{"NextParagraph", "|a\nb^\n"},
+	{"PrevParagraph", "a\n^\nb\n|c\n"},
+	{"PrevParagraph", "^a\nb\n|c\n"},
+	{"PrevParagraph", "a\n^\nb\n\n|\n"},
+	{"MatchBracket", "|(a (b) ^)\n"},
+	{"MatchBracket", "^(a (b) |)\n"},
+	{"MatchBracket", "|x = f[^]\n"},
+	{"MatchBracket", "^{\n\t{}\n|}\n"},
+	{"MatchBracket", "a^b (\n"},
+	{"MatchBracket", "a ^b\n(c)\n"},
+	{"f", "|abc^xdx\n"},
+	{"f", "^abc\nx\n"},
+	{"t", "|ab^cxdx\n"},
+	{"t", "ab|^xx\n"},
+	{"F", "x^xab|c\n"},
+	{"f", "^\nx\n"},
+	{"F", "x\n^abc\n"},
+	{"T", "xx^ab|c\n"},
+}
+
+func TestMotions(t *testing.T) {
+	for i, tst := range motiontests {
+		text := tst.text
+		start, expect := strings.Index(text, "|"), strings.Index(text, "^")
+		if start == -1 {
+			start = expect
+		} else if start < expect {
+			expect--
+		} else {
+			start--
+		}
+		text = strings.Replace(strings.Replace(text, "|", "", 1), "^", "", 1)
+
+		b := NewBuffer([]byte(text))
+		if got := motions[tst.name](b, start); got != expect {
+			t.Errorf("test %v: %v(%q, %v): expected %v, got %v", i, tst.name, text, start, expect, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package util
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// maxChunk is the largest number of bytes stored in a single rope node.
+const maxChunk = 1024
+
+// node is a node of a rope implemented as an implicit treap. Each node holds
+// a chunk of text; the in-order concatenation of all chunks is the content of
+// the rope. Every node caches the byte and newline counts of its subtree so
+// that offset and line lookups take logarithmic time.
+type node struct {
+	text        []byte
+	nls         int // newlines in text
+	left, right *node
+	prio        int32
+	size        int // bytes in subtree
+	nl          int // newlines in subtree
+}
+
+func newNode(text []byte) *node {
+	n := &node{text: text, nls: bytes.Count(text, newline), prio: rand.Int31()}
+	n.update()
+	return n
+}
+
+var newline = []byte("\n")
+
+func (n *node) update() {
+	n.size = len(n.text) + bytesIn(n.left) + bytesIn(n.right)
+	n.nl = n.nls + newlinesIn(n.left) + newlinesIn(n.right)
+}
+
+// bytesIn returns the number of bytes in the subtree rooted at n.
+func bytesIn(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// newlinesIn returns the number of '\n' bytes in the subtree rooted at n.
+func newlinesIn(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.nl
+}
+
+// build creates a rope holding a copy of text.
+func build(text []byte) *node {
+	var root *node
+	for len(text) > 0 {
+		k := Min(len(text), maxChunk)
+		chunk := append([]byte{}, text[:k]...)
+		root = merge(root, newNode(chunk))
+		text = text[k:]
+	}
+	return root
+}
+
+// merge joins the ropes a and b with all of a's content before b's.
+func merge(a, b *node) *node {
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	if a.prio > b.prio {
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.update()
+	return b
+}
+
+// split divides the rope n into one holding its first off bytes and another
+// holding the rest.
+func split(n *node, off int) (l, r *node) {
+	if n == nil {
+		return nil, nil
+	}
+
+	ls := bytesIn(n.left)
+	switch {
+	case off <= ls:
+		l, n.left = split(n.left, off)
+		n.update()
+		return l, n
+	case off >= ls+len(n.text):
+		n.right, r = split(n.right, off-ls-len(n.text))
+		n.update()
+		return n, r
+	default:
+		k := off - ls
+		l = merge(n.left, newNode(n.text[:k:k]))
+		r = merge(newNode(n.text[k:]), n.right)
+		return l, r
+	}
+}
+
+// appendText adds text to the end of the last chunk of n if it fits and
+// reports whether it did.
+func appendText(n *node, text []byte) bool {
+	if n == nil {
+		return false
+	}
+	if n.right != nil {
+		if !appendText(n.right, text) {
+			return false
+		}
+	} else if len(n.text)+len(text) > maxChunk {
+		return false
+	} else {
+		n.text = append(n.text[:len(n.text):len(n.text)], text...)
+		n.nls += bytes.Count(text, newline)
+	}
+	n.update()
+	return true
+}
+
+// appendTo appends the bytes of n in the range [start, end) to dst.
+func appendTo(dst []byte, n *node, start, end int) []byte {
+	if n == nil || start >= end || end <= 0 || start >= n.size {
+		return dst
+	}
+	ls := bytesIn(n.left)
+	dst = appendTo(dst, n.left, start, end)
+	lo, hi := Max(start-ls, 0), Min(end-ls, len(n.text))
+	if lo < hi {
+		dst = append(dst, n.text[lo:hi]...)
+	}
+	off := ls + len(n.text)
+	return appendTo(dst, n.right, start-off, end-off)
+}
+
+// newlineOffset returns the byte offset just past the k'th (1-based) newline
+// in n.
+func newlineOffset(n *node, k int) int {
+	base := 0
+	for n != nil {
+		if ln := newlinesIn(n.left); k <= ln {
+			n = n.left
+			continue
+		}
+		k -= newlinesIn(n.left)
+		base += bytesIn(n.left)
+
+		if k <= n.nls {
+			for i, c := range n.text {
+				if c == '\n' {
+					k--
+					if k == 0 {
+						return base + i + 1
+					}
+				}
+			}
+		}
+		k -= n.nls
+		base += len(n.text)
+		n = n.right
+	}
+	return base
+}
+
+// countNewlines returns the number of newlines in the first off bytes of n.
+func countNewlines(n *node, off int) int {
+	count := 0
+	for n != nil && off > 0 {
+		ls := bytesIn(n.left)
+		if off <= ls {
+			n = n.left
+			continue
+		}
+		count += newlinesIn(n.left)
+		off -= ls
+		if off <= len(n.text) {
+			return count + bytes.Count(n.text[:off], newline)
+		}
+		count += n.nls
+		off -= len(n.text)
+		n = n.right
+	}
+	return count
+}
@@ -0,0 +1,324 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextObject returns the byte range [start, end) of the text object at
+// offset: its inner part without surrounding white space or delimiters if
+// inner is true, or all of it otherwise. ok is false if there is no such
+// object at offset.
+type TextObject func(b *Buffer, offset int, inner bool) (start, end int, ok bool)
+
+// Word is the TextObject for words. The inner word is the run of word,
+// punctuation or space characters at offset; the whole word includes the
+// space after it, or before it if there is none.
+func Word(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+	return word(b, offset, inner, wordClass)
+}
+
+// BigWord is like Word for WORDs.
+func BigWord(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+	return word(b, offset, inner, bigWordClass)
+}
+
+func word(b *Buffer, offset int, inner bool, class func(rune) int) (start, end int, ok bool) {
+	r, size := b.RuneAt(offset)
+	if size == 0 || r == '\n' {
+		return offset, offset, false
+	}
+	start, end = run(b, offset, class)
+	if inner {
+		return start, end, true
+	}
+
+	if class(r) == classSpace {
+		if r, size := b.RuneAt(end); size > 0 && r != '\n' {
+			_, end = run(b, end, class)
+		}
+	} else if r, size := b.RuneAt(end); size > 0 && r != '\n' && class(r) == classSpace {
+		_, end = run(b, end, class)
+	} else if r, size := b.RuneBefore(start); size > 0 && r != '\n' && class(r) == classSpace {
+		start, _ = run(b, start-size, class)
+	}
+	return start, end, true
+}
+
+// run returns the range of the characters on offset's line around it that
+// are of the same class.
+func run(b *Buffer, offset int, class func(rune) int) (start, end int) {
+	r, _ := b.RuneAt(offset)
+	c := class(r)
+	same := func(r rune, size int) bool { return size > 0 && r != '\n' && class(r) == c }
+	for start = offset; same(b.RuneBefore(start)); {
+		_, size := b.RuneBefore(start)
+		start -= size
+	}
+	for end = offset; same(b.RuneAt(end)); {
+		_, size := b.RuneAt(end)
+		end += size
+	}
+	return start, end
+}
+
+// Sentence is the TextObject for sentences, which end at a '.', '!' or '?'
+// followed by white space, optionally with closing brackets and quotes in
+// between, and at the end of paragraphs. The whole sentence includes the
+// space after it, or before it if there is none.
+func Sentence(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+	l, _ := b.Pos(offset)
+	if l >= b.Nlines() || len(b.Line(l)) <= 1 {
+		return offset, offset, false
+	}
+	first, last := l, l
+	for first > 0 && len(b.Line(first-1)) > 1 {
+		first--
+	}
+	for last+1 < b.Nlines() && len(b.Line(last+1)) > 1 {
+		last++
+	}
+	pstart := b.Offset(first, 0)
+	text := b.Slice(pstart, b.Offset(last+1, 0))
+	skipSpace := func(i int) int {
+		for i < len(text) {
+			r, size := utf8.DecodeRune(text[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+		return i
+	}
+
+	// each sentence is split into its text [start, trail) and the space
+	// [trail, end) after it, which is empty at the end of the paragraph.
+	var bounds [][3]int
+	from := 0
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; c != '.' && c != '!' && c != '?' {
+			continue
+		}
+		j := i + 1
+		for j < len(text) && strings.IndexByte(`)]"'`, text[j]) >= 0 {
+			j++
+		}
+		if j == len(text) || skipSpace(j) == j {
+			continue
+		}
+		k := skipSpace(j)
+		if k == len(text) {
+			break
+		}
+		bounds = append(bounds, [3]int{from, j, k})
+		from, i = k, k-1
+	}
+	trail := len(text)
+	for trail > from {
+		r, size := utf8.DecodeLastRune(text[:trail])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		trail -= size
+	}
+	bounds = append(bounds, [3]int{from, trail, trail})
+
+	for n, bd := range bounds {
+		start, trail, end := pstart+bd[0], pstart+bd[1], pstart+bd[2]
+		if end <= offset && n < len(bounds)-1 {
+			continue
+		}
+		if inner && offset >= trail && end > trail {
+			return trail, end, true // in the space after it
+		} else if inner {
+			return start, trail, true
+		} else if end > trail {
+			return start, end, true
+		}
+		for start > pstart {
+			r, size := b.RuneBefore(start)
+			if !unicode.IsSpace(r) || r == '\n' {
+				break
+			}
+			start -= size
+		}
+		return start, trail, true
+	}
+	return offset, offset, false
+}
+
+// Paragraph is the TextObject for paragraphs, whose ranges are whole lines.
+// The inner paragraph is the run of non-empty, or of empty, lines containing
+// offset; the whole paragraph includes the empty lines after it, or before it
+// if there are none.
+func Paragraph(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+	l, _ := b.Pos(offset)
+	if l >= b.Nlines() {
+		return offset, offset, false
+	}
+	empty := func(l int) bool { return len(b.Line(l)) <= 1 }
+	e := empty(l)
+	first, last := l, l
+	for first > 0 && empty(first-1) == e {
+		first--
+	}
+	for last+1 < b.Nlines() && empty(last+1) == e {
+		last++
+	}
+	if inner {
+		return b.Offset(first, 0), b.Offset(last+1, 0), true
+	}
+
+	if last+1 < b.Nlines() {
+		for last+1 < b.Nlines() && empty(last+1) != e {
+			last++
+		}
+	} else if !e {
+		for first > 0 && empty(first-1) {
+			first--
+		}
+	}
+	return b.Offset(first, 0), b.Offset(last+1, 0), true
+}
+
+// Quote returns the TextObject for strings delimited by q on a line, where
+// a q preceded by a backslash does not count. Quotes on a line pair up from
+// its start; if offset is not in a pair, the next one on the line is used.
+// The inner string excludes the quotes; the whole string includes the space
+// after them, or before them if there is none.
+func Quote(q rune) TextObject {
+	return func(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+		l, _ := b.Pos(offset)
+		if l >= b.Nlines() {
+			return offset, offset, false
+		}
+		var quotes []int
+		pos := b.Offset(l, 0)
+		escaped := false
+		for _, r := range b.Line(l) {
+			if r == q && !escaped {
+				quotes = append(quotes, pos)
+			}
+			escaped = r == '\\' && !escaped
+			pos += utf8.RuneLen(r)
+		}
+
+		for i := 0; i+1 < len(quotes); i += 2 {
+			open, close := quotes[i], quotes[i+1]
+			if close < offset {
+				continue
+			}
+			_, size := b.RuneAt(close)
+			start, end = open, close+size
+			if inner {
+				_, size := b.RuneAt(open)
+				return open + size, close, true
+			}
+			if r, size := b.RuneAt(end); size > 0 && r != '\n' && wordClass(r) == classSpace {
+				_, end = run(b, end, wordClass)
+			} else if r, size := b.RuneBefore(start); size > 0 && r != '\n' && wordClass(r) == classSpace {
+				start, _ = run(b, start-size, wordClass)
+			}
+			return start, end, true
+		}
+		return offset, offset, false
+	}
+}
+
+// Bracket returns the TextObject for the text between the open and close
+// brackets enclosing offset, or at it. The inner text excludes the brackets;
+// if they end and start lines, it is the whole lines between them.
+func Bracket(open, close rune) TextObject {
+	return func(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+		start = -1
+		if r, _ := b.RuneAt(offset); r == open {
+			start = offset
+		} else {
+			depth := 0
+			for pos := offset; pos > 0; {
+				r, size := b.RuneBefore(pos)
+				pos -= size
+				if r == close {
+					depth++
+				} else if r == open && depth > 0 {
+					depth--
+				} else if r == open {
+					start = pos
+					break
+				}
+			}
+		}
+		if start == -1 {
+			return offset, offset, false
+		}
+
+		_, osize := b.RuneAt(start)
+		depth := 0
+		for pos := start + osize; ; {
+			r, size := b.RuneAt(pos)
+			if size == 0 {
+				return offset, offset, false
+			} else if r == open {
+				depth++
+			} else if r == close && depth > 0 {
+				depth--
+			} else if r == close {
+				end = pos
+				break
+			}
+			pos += size
+		}
+
+		if !inner {
+			_, size := b.RuneAt(end)
+			return start, end + size, true
+		}
+		start += osize
+		if r, _ := b.RuneAt(start); r == '\n' {
+			if ls := LineStart(b, end); ls > start && FirstNonBlank(b, ls) == end {
+				return start + 1, ls, true
+			}
+		}
+		return start, end, true
+	}
+}
+
+var tagRe = regexp.MustCompile(`<(/?)([A-Za-z][^\s/>]*)[^>]*?(/?)>`)
+
+// Tag is the TextObject for XML and HTML elements: the innermost pair of
+// matching tags around offset and the text between them, which the inner
+// element is made of.
+func Tag(b *Buffer, offset int, inner bool) (start, end int, ok bool) {
+	type tag struct {
+		name       string
+		start, end int
+	}
+	var open []tag
+	data := b.Bytes()
+	for _, m := range tagRe.FindAllSubmatchIndex(data, -1) {
+		if m[7] > m[6] {
+			continue // self-closing
+		}
+		t := tag{string(data[m[4]:m[5]]), m[0], m[1]}
+		if m[3] == m[2] {
+			open = append(open, t)
+			continue
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i].name != t.name {
+				continue
+			}
+			// the first element closed around offset is the innermost
+			if o := open[i]; o.start <= offset && offset < t.end && inner {
+				return o.end, t.start, true
+			} else if o.start <= offset && offset < t.end {
+				return o.start, t.end, true
+			}
+			open = open[:i] // drop unclosed tags such as <br> in between
+			break
+		}
+	}
+	return offset, offset, false
+}
@@ -0,0 +1,102 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+// objtest holds a text with the offset marked by '|' and the expected range
+// by '«' and '»', or no range if the object is not found.
+type objtest struct {
+	obj   string
+	inner bool
+	text  string
+}
+
+var objects = map[string]TextObject{
+	"Word":      Word,
+	"BigWord":   BigWord,
+	"Sentence":  Sentence,
+	"Paragraph": Paragraph,
+	`Quote"`:    Quote('"'),
+	"Bracket(":  Bracket('(', ')'),
+	"Bracket{":  Bracket('{', '}'),
+	"Bracket<":  Bracket('<', '>'),
+	"Tag":       Tag,
+}
+
+var objtests = []objtest{
+	{"Word", true, "foo «b|ar» baz\n"},
+	{"Word", false, "foo «b|ar »baz\n"},
+	{"Word", false, "foo« b|ar»\n"},
+	{"Word", false, "foo«  |  baz» x\n"},
+	{"Word", true, "foo.«b|ar»\n"},
+	{"Word", true, "«wö|rld»\n"},
+	{"Word", true, "x\n|\n"},
+	{"BigWord", true, "x «foo.b|ar» y\n"},
+	{"BigWord", false, "x «foo.b|ar »y\n"},
+	{"Sentence", true, "«Hello th|ere.» Bye now.\n"},
+	{"Sentence", false, "«Hello th|ere. »Bye now.\n"},
+	{"Sentence", true, "Hello there. «Bye| (now).»\n"},
+	{"Sentence", false, "Hello there.« Bye| now.»\n"},
+	{"Sentence", true, "One.\n\n«Two |is\nhere!»\n"},
+	{"Sentence", true, "«A e.g.x| b»\n"},
+	{"Sentence", true, "a\n|\nb\n"},
+	{"Paragraph", true, "«a\nb|\n»\nc\n"},
+	{"Paragraph", false, "«a\nb|\n\n\n»c\n"},
+	{"Paragraph", false, "a\n«\n\nb|\n»"},
+	{"Paragraph", true, "a\n«|\n\n»b\n"},
+	{"Paragraph", false, "a\n«|\n\nb\n»\nc\n"},
+	{`Quote"`, true, `x = "«a |b»" + "c"` + "\n"},
+	{`Quote"`, false, `x = «"a |b" »+ "c"` + "\n"},
+	{`Quote"`, true, `x| = "«a»"` + "\n"},
+	{`Quote"`, true, `"a" |+ "«b»"` + "\n"},
+	{`Quote"`, true, `"«a \"|b\"»"` + "\n"},
+	{`Quote"`, false, `x« "a|"»` + "\n"},
+	{`Quote"`, true, `"a" |` + "\n"},
+	{"Bracket(", true, "f(«a, (b), |c»)\n"},
+	{"Bracket(", false, "f«(a, (b), |c)»\n"},
+	{"Bracket(", true, "f(a, («|b»), c)\n"},
+	{"Bracket(", true, "f(a, |(«b»), c)\n"},
+	{"Bracket(", true, "f(a, («b|»), c)\n"},
+	{"Bracket(", true, "|f(a)\n"},
+	{"Bracket{", true, "if x {\n«\tfoo|()\n\tbar\n»}\n"},
+	{"Bracket{", true, "{«a|»}\n"},
+	{"Bracket<", false, "vector«<i|nt>»\n"},
+	{"Tag", true, "<a><b>«x|y»</b></a>\n"},
+	{"Tag", false, "<a>«<b>x|y</b>»</a>\n"},
+	{"Tag", true, "<a>«<b>x</b> |z»</a>\n"},
+	{"Tag", true, "<div class=\"x\">«<br/> |<br>»</div>\n"},
+	{"Tag", false, "«<p|>x</p>»\n"},
+	{"Tag", true, "<a>x</a> |y\n"},
+}
+
+// marks returns text without the markers '|', '«' and '»' and the offsets
+// they were at in it, or -1 for missing ones.
+func marks(text string) (string, map[rune]int) {
+	pos := map[rune]int{'|': -1, '«': -1, '»': -1}
+	var b strings.Builder
+	for _, r := range text {
+		if _, ok := pos[r]; ok {
+			pos[r] = b.Len()
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), pos
+}
+
+func TestTextObjects(t *testing.T) {
+	for i, tst := range objtests {
+		text, pos := marks(tst.text)
+		offset, start, end := pos['|'], pos['«'], pos['»']
+		found := start != -1
+
+		b := NewBuffer([]byte(text))
+		s, e, ok := objects[tst.obj](b, offset, tst.inner)
+		if ok != found || (ok && (s != start || e != end)) {
+			t.Errorf("test %v: %v(%q, %v, %v): expected %v-%v (%v), got %v-%v (%v)",
+				i, tst.obj, text, offset, tst.inner, start, end, found, s, e, ok)
+		}
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"fmt"
 	"strings"
 
+	termbox "github.com/nsf/termbox-go"
 	"github.com/rwcarlsen/editor/util"
 )
 
 type LineNum struct {
 	View
-	b       *util.Buffer
-	w, h    int
-	ndigits int
+	// GutterFg and GutterBg are the attributes line numbers are drawn with.
+	GutterFg, GutterBg termbox.Attribute
+	b                  *util.Buffer
+	w, h               int
+	ndigits            int
 }
 
 func (v *LineNum) Render() Surface {
@@ -42,6 +45,8 @@ func (v *LineNum) Render() Surface {
 		Surface: surf,
 		ndigits: v.ndigits,
 		nums:    linenums,
+		fg:      v.GutterFg,
+		bg:      v.GutterBg,
 	}
 }
 
@@ -62,6 +67,7 @@ type LineNumSurf struct {
 	Surface
 	ndigits int
 	nums    map[int]map[int]rune
+	fg, bg  termbox.Attribute
 }
 
 func (s *LineNumSurf) Char(x, y int) int {
@@ -77,6 +83,12 @@ func (s *LineNumSurf) Rune(x, y int) rune {
 		return s.Surface.Rune(x-s.ndigits, y)
 	}
 }
+func (s *LineNumSurf) Attr(x, y int) (fg, bg termbox.Attribute) {
+	if x < s.ndigits {
+		return s.fg, s.bg
+	}
+	return s.Surface.Attr(x-s.ndigits, y)
+}
 func (s *LineNumSurf) X(line, char int) int {
 	return s.Surface.X(line, char) + s.ndigits
 }
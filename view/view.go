@@ -19,6 +19,8 @@ type Surface interface {
 	Char(x, y int) int
 	Line(x, y int) int
 	Rune(x, y int) rune
+	// Attr returns the attributes the cell at x, y is drawn with.
+	Attr(x, y int) (fg, bg termbox.Attribute)
 	X(line, char int) int
 	Y(line, char int) int
 	Size() (w, h int)
@@ -28,11 +30,76 @@ func Draw(s Surface, xorigin, yorigin int) {
 	w, h := s.Size()
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
-			termbox.SetCell(xorigin+x, yorigin+y, s.Rune(x, y), 0, 0)
+			fg, bg := s.Attr(x, y)
+			termbox.SetCell(xorigin+x, yorigin+y, s.Rune(x, y), fg, bg)
 		}
 	}
 }
 
+// Mark redraws the cells of s that show characters for which in returns true
+// using the given attributes. A zero fg or bg keeps the cell's own attribute.
+func Mark(s Surface, xorigin, yorigin int, in func(line, char int) bool, fg, bg termbox.Attribute) {
+	w, h := s.Size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			l, ch := DataPos(s, x, y)
+			if l != -1 && ch != -1 && in(l, ch) {
+				mark(s, xorigin, yorigin, x, y, fg, bg)
+			}
+		}
+	}
+}
+
+// MarkRange is like Mark but redraws the cells showing the bytes [start,
+// end) of b.
+func MarkRange(s Surface, xorigin, yorigin int, b *util.Buffer, start, end int, fg, bg termbox.Attribute) {
+	l, ch := b.Pos(start)
+	for off := start; off < end; {
+		r, size := b.RuneAt(off)
+		if size == 0 {
+			break
+		}
+		if x, y := RenderPos(s, l, ch); x != -1 && y != -1 {
+			mark(s, xorigin, yorigin, x, y, fg, bg)
+		}
+		off += size
+		if r == '\n' {
+			l, ch = l+1, 0
+		} else {
+			ch++
+		}
+	}
+}
+
+func mark(s Surface, xorigin, yorigin, x, y int, fg, bg termbox.Attribute) {
+	cfg, cbg := s.Attr(x, y)
+	if fg != 0 {
+		cfg = fg
+	}
+	if bg != 0 {
+		cbg = bg
+	}
+	termbox.SetCell(xorigin+x, yorigin+y, s.Rune(x, y), cfg, cbg)
+}
+
+// Lines returns the first and last buffer lines shown on s, or -1, -1 if
+// none are.
+func Lines(s Surface) (first, last int) {
+	first, last = -1, -1
+	w, h := s.Size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if l := s.Line(x, y); l != -1 {
+				if first == -1 || l < first {
+					first = l
+				}
+				last = util.Max(last, l)
+			}
+		}
+	}
+	return first, last
+}
+
 func Contains(s Surface, line, char int) bool {
 	x, y := RenderPos(s, line, char)
 	return x != -1 && y != -1
@@ -89,12 +156,26 @@ func (c *WrapSurf) Rune(x, y int) rune {
 	return c.b.Rune(l, ch)
 }
 
+func (c *WrapSurf) Attr(x, y int) (fg, bg termbox.Attribute) {
+	l, ch := DataPos(c, x, y)
+	if l == -1 || ch == -1 {
+		return 0, 0
+	}
+	return c.b.Attr(l, ch)
+}
+
 func (c *WrapSurf) Char(x, y int) int {
-	return c.chars[y][x]
+	if v, ok := c.chars[y][x]; ok {
+		return v
+	}
+	return -1
 }
 
 func (c *WrapSurf) Line(x, y int) int {
-	return c.lines[y][x]
+	if v, ok := c.lines[y][x]; ok {
+		return v
+	}
+	return -1
 }
 
 func (c *WrapSurf) X(line, char int) int {